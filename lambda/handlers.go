@@ -3,10 +3,14 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
 	"net/url"
-	"os"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -15,34 +19,36 @@ import (
 
 // Handle a request.
 func handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	ctx = print2pdf.ContextWithLogger(ctx, slog.Default().With("request_id", event.RequestContext.RequestID))
+	defer emitMetrics(ctx)
 	headers := map[string]string{"Content-Type": "application/json"}
 	origin, ok := event.Headers["Origin"]
 	if !ok {
 		origin = event.Headers["origin"]
 	}
 	if allowOrigin, err := getCorsOriginHeader(origin); err != nil {
-		fmt.Fprintf(os.Stderr, "error getting CORS allow-origin header value: %s\n", err)
+		logger(ctx).Error("error getting CORS allow-origin header value", "error", err)
 
 		return jsonError("internal server error", 500), nil
 	} else if allowOrigin != "" {
 		headers["Access-Control-Allow-Methods"] = "OPTIONS,POST"
-		headers["Access-Control-Allow-Headers"] = "Content-Type"
+		headers["Access-Control-Allow-Headers"] = allowedHeaders()
 		headers["Access-Control-Allow-Credentials"] = "true"
 		headers["Access-Control-Allow-Origin"] = origin
 	}
 
-	var data print2pdf.GetPDFParams
+	var data PrintRequest
 	err := json.Unmarshal([]byte(event.Body), &data)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error decoding JSON: %s\noriginal request body: %s\n", err, event.Body)
+		logger(ctx).Error("error decoding JSON", "error", err)
 
 		return jsonError("internal server error", 500), nil
 	}
-	if !strings.HasSuffix(data.FileName, ".pdf") {
-		data.FileName += ".pdf"
+	if _, o, err := data.OutputFormat(); err == nil && !strings.HasSuffix(data.FileName, o.Extension) {
+		data.FileName += o.Extension
 	}
-	if err := checkPrintIsAllowed(data.Url); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+	if err := checkPrintIsAllowed(data.DocumentUrl()); err != nil {
+		logger(ctx).Warn("URL not allowed", "error", err)
 
 		return jsonError("URL is not allowed", 403), nil
 	}
@@ -55,27 +61,62 @@ func handler(ctx context.Context, event events.APIGatewayProxyRequest) (events.A
 		cookies := strings.Split(cookieHeader, ";")
 		data.Cookies = extractCookies(cookies)
 	}
+	data.Headers = addForwardedHeaders(data.Headers, func(name string) string {
+		// Header names in API Gateway events keep the case used by the client.
+		for n, v := range event.Headers {
+			if strings.EqualFold(n, name) {
+				return v
+			}
+		}
+
+		return ""
+	})
 	h, err := print2pdf.NewS3Handler(ctx, BucketName, data.FileName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error creating print handler: %s\n", err)
+		logger(ctx).Error("error creating print handler", "error", err)
 
 		return jsonError("internal server error", 500), nil
 	}
 
-	url, err := print2pdf.PrintPDF(ctx, data, h)
+	url, diag, err := print2pdf.PrintPDFWithDiagnostics(ctx, data.GetPDFParams, h)
+	logDiagnostics(ctx, diag)
 	if ve, ok := err.(print2pdf.ValidationError); ok {
-		fmt.Fprintf(os.Stderr, "request validation error: %s\n", ve)
+		logger(ctx).Warn("request validation error", "error", ve)
 
 		return jsonError(ve.Error(), 400), nil
+	} else if errors.Is(err, print2pdf.ErrQueueTimeout) {
+		logger(ctx).Error("error getting PDF", "error", err)
+
+		return jsonError("server busy, try again later", 503), nil
+	} else if errors.Is(err, print2pdf.ErrWaitTimeout) {
+		logger(ctx).Error("error getting PDF", "error", err)
+
+		return jsonError(err.Error(), 504), nil
+	} else if denied := new(print2pdf.DeniedRequestError); errors.As(err, denied) {
+		logger(ctx).Error("error getting PDF", "error", err)
+
+		return jsonError(denied.Error(), 403), nil
+	} else if status := new(print2pdf.HttpStatusError); errors.As(err, status) {
+		logger(ctx).Error("error getting PDF", "error", err)
+
+		return jsonResponseError(ResponseError{Message: status.Error(), Status: status.StatusCode}, 502), nil
+	} else if exception := new(print2pdf.ExceptionError); errors.As(err, exception) {
+		logger(ctx).Error("error getting PDF", "error", err)
+
+		return jsonError(exception.Error(), 502), nil
 	} else if err != nil {
-		fmt.Fprintf(os.Stderr, "error getting PDF: %s\n", err)
+		logger(ctx).Error("error getting PDF", "error", err)
 
 		return jsonError("internal server error", 500), nil
 	}
 
-	body, err := json.Marshal(ResponseData{Url: url})
+	response := ResponseData{Url: url}
+	if data.Diagnostics {
+		response.Diagnostics = diag
+	}
+	body, err := json.Marshal(response)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error encoding response to JSON: %s\n", err)
+		logger(ctx).Error("error encoding response to JSON", "error", err)
 
 		return jsonError("internal server error", 500), nil
 	}
@@ -117,11 +158,15 @@ func getCorsOriginHeader(origin string) (string, error) {
 	return "", nil
 }
 
-// checkPrintIsAllowed checks that printing the URL is allowed.
+// checkPrintIsAllowed checks that printing the URL is allowed. When allowed hosts are configured, an empty URL, as for HTML
+// content without a base URL, is never allowed, as the content could load any page.
 func checkPrintIsAllowed(u string) error {
 	if PrintAllowedHosts == "" || PrintAllowedHosts == "*" {
 		return nil
 	}
+	if u == "" {
+		return fmt.Errorf("HTML content without a base URL is not allowed for printing")
+	}
 
 	parsedUrl, err := url.Parse(u)
 	if err != nil {
@@ -139,12 +184,12 @@ func checkPrintIsAllowed(u string) error {
 	return nil
 }
 
-// extractCookies extracts cookies from the request matching the specified names.
+// extractCookies extracts cookies from the request matching the specified names or forwarded to other domains.
 // Parameters:
 // - cookies: the request cookies
 // Returns:
-// - a map with cookie names as keys and their values as map values
-func extractCookies(cookies []string) map[string]string {
+// - the cookies to set for the host of the document and for the configured domains
+func extractCookies(cookies []string) []*print2pdf.Cookie {
 	// Create a lookup map for desired cookie names
 	names := strings.Split(ForwardCookies, ",")
 	wanted := make(map[string]bool)
@@ -153,7 +198,7 @@ func extractCookies(cookies []string) map[string]string {
 	}
 
 	// Collect found cookies
-	forward := make(map[string]string)
+	var forward []*print2pdf.Cookie
 	for _, cookie := range cookies {
 		name, value, found := strings.Cut(strings.TrimSpace(cookie), "=")
 		if !found {
@@ -161,20 +206,104 @@ func extractCookies(cookies []string) map[string]string {
 		}
 
 		name = strings.TrimSpace(name)
-		if wanted[name] {
-			forward[name] = strings.TrimSpace(value)
-		}
+		forward = append(forward, forwardCookie(wanted[name], name, strings.TrimSpace(value))...)
 	}
 
 	return forward
 }
 
+// forwardCookie creates the cookies to set for a forwarded cookie: one for the host of the document if wanted, and one
+// for each configured domain. Cookies for other domains are sent with cross-site requests, so they must be secure.
+func forwardCookie(wanted bool, name, value string) []*print2pdf.Cookie {
+	var cookies []*print2pdf.Cookie
+	if wanted {
+		cookies = append(cookies, &print2pdf.Cookie{Name: name, Value: print2pdf.Secret(value)})
+	}
+	for _, domain := range cookieDomains[name] {
+		secure := true
+		cookies = append(cookies, &print2pdf.Cookie{
+			Name:     name,
+			Value:    print2pdf.Secret(value),
+			Domain:   domain,
+			Secure:   &secure,
+			SameSite: "none",
+		})
+	}
+
+	return cookies
+}
+
+// Get the value of the Access-Control-Allow-Headers header, including forwarded headers.
+func allowedHeaders() string {
+	return strings.Join(append([]string{"Content-Type"}, forwardedHeaderNames()...), ", ")
+}
+
+// Get the names of the headers to forward.
+func forwardedHeaderNames() []string {
+	var names []string
+	for _, name := range strings.Split(ForwardHeaders, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+
+	return names
+}
+
+// addForwardedHeaders adds the request headers matching the forwarded names to the headers, unless already present.
+func addForwardedHeaders(headers map[string]string, get func(name string) string) map[string]string {
+	for _, name := range forwardedHeaderNames() {
+		value := get(name)
+		if value == "" || slices.ContainsFunc(slices.Collect(maps.Keys(headers)), func(n string) bool { return strings.EqualFold(n, name) }) {
+			continue
+		}
+
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[name] = value
+	}
+
+	return headers
+}
+
+// Write the diagnostics of a page to the logs at debug level.
+func logDiagnostics(ctx context.Context, diag *print2pdf.Diagnostics) {
+	l := logger(ctx)
+	if diag == nil || !l.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	for _, m := range diag.Console {
+		l.Debug("console message", "level", m.Level, "text", m.Text, "url", m.Url, "line", m.Line)
+	}
+	for _, e := range diag.Exceptions {
+		l.Debug("uncaught exception", "message", e.Message, "url", e.Url, "line", e.Line, "column", e.Column)
+	}
+	for _, r := range diag.FailedRequests {
+		l.Debug("failed request", "url", r.Url, "resource_type", r.ResourceType, "error", r.Error, "status", r.Status)
+	}
+	if diag.Dropped > 0 {
+		l.Debug("diagnostics dropped", "count", diag.Dropped)
+	}
+}
+
+// Get the logger of a request, carrying its request ID.
+func logger(ctx context.Context) *slog.Logger {
+	return print2pdf.LoggerFromContext(ctx)
+}
+
 // Prepare an HTTP error response.
 func jsonError(message string, code int) events.APIGatewayProxyResponse {
+	return jsonResponseError(ResponseError{Message: message}, code)
+}
+
+// Prepare an HTTP error response with the specified error body.
+func jsonResponseError(res ResponseError, code int) events.APIGatewayProxyResponse {
 	ct := "application/json"
-	body, err := json.Marshal(ResponseError{message})
+	body, err := json.Marshal(res)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error encoding error message to JSON: %s\noriginal error: %s\n", err, message)
+		slog.Error("error encoding error message to JSON", "error", err, "original_error", res.Message)
 		body = []byte("internal server error")
 		code = 500
 		ct = "text/plain"
@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"net/netip"
 	"os"
 	"os/signal"
 	"slices"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/chialab/print2pdf-go/print2pdf"
@@ -15,11 +20,22 @@ import (
 // ResponseData represents a JSON-structured response.
 type ResponseData struct {
 	Url string `json:"url"`
+	// Diagnostics of the page, if requested.
+	Diagnostics *print2pdf.Diagnostics `json:"diagnostics,omitempty"`
+}
+
+// PrintRequest represents the JSON-structured body of a request, with the options of the function along with print parameters.
+type PrintRequest struct {
+	print2pdf.GetPDFParams
+	// Include diagnostics of the page in the response.
+	Diagnostics bool `json:"diagnostics,omitempty"`
 }
 
 // ResponseError represents a JSON-structured error response.
 type ResponseError struct {
 	Message string `json:"message"`
+	// HTTP status code of the document, when it responded with an error.
+	Status int `json:"status,omitempty"`
 }
 
 // Version string, set at build time.
@@ -34,24 +50,88 @@ var CorsAllowedHosts = os.Getenv("CORS_ALLOWED_HOSTS")
 // Comma-separated list of cookies to forward when navigating to the URL to be printed.
 var ForwardCookies = os.Getenv("FORWARD_COOKIES")
 
+// Comma-separated list of name=domain pairs of cookies to forward to other domains (e.g. "session=api.example.com").
+var ForwardCookiesDomains = os.Getenv("FORWARD_COOKIES_DOMAINS")
+
+// Domains each cookie is forwarded to, in addition to the host of the document.
+var cookieDomains = map[string][]string{}
+
+// Comma-separated list of headers to forward when navigating to the URL to be printed.
+var ForwardHeaders = os.Getenv("FORWARD_HEADERS")
+
 // Comma-separated list of hosts for which printing is allowed.
 var PrintAllowedHosts = os.Getenv("PRINT_ALLOWED_HOSTS")
 
+// Minimum level of logs, one of "debug", "info", "warn" or "error". Defaults to "info". Diagnostics of printed pages,
+// such as console messages and uncaught exceptions, are logged at debug level.
+var LogLevel = os.Getenv("LOG_LEVEL")
+
+// Whether requests to private and local networks are denied, "true" or "false". Defaults to "true".
+var PrintDenyPrivateNetworks = os.Getenv("PRINT_DENY_PRIVATE_NETWORKS")
+
+// Comma-separated list of networks, in CIDR notation, that can be reached even if they are private or local.
+var PrintAllowedNetworks = os.Getenv("PRINT_ALLOWED_NETWORKS")
+
+// Number of browser processes to start. Defaults to 1.
+var BrowserPoolSize = os.Getenv("BROWSER_POOL_SIZE")
+
+// Maximum number of concurrent tabs for each browser process. Defaults to 10, 0 means no limit.
+var BrowserMaxTabs = os.Getenv("BROWSER_MAX_TABS")
+
+// Maximum time to wait for a free browser tab, as a duration string (e.g. "30s"). Defaults to 30 seconds, 0 means no limit.
+var BrowserQueueTimeout = os.Getenv("BROWSER_QUEUE_TIMEOUT")
+
+// Comma-separated list of URL patterns of requests blocked when loading every document.
+var BlockUrls = os.Getenv("BLOCK_URLS")
+
+// Comma-separated list of URL patterns of requests never blocked, taking precedence over blocked ones.
+var BlockAllowUrls = os.Getenv("BLOCK_ALLOW_URLS")
+
+// Comma-separated list of resource types of requests blocked when loading every document.
+var BlockResourceTypes = os.Getenv("BLOCK_RESOURCE_TYPES")
+
+// Path of a directory with CSS and JavaScript files injected in every document, in alphabetical order.
+var AssetsDir = os.Getenv("ASSETS_DIR")
+
+// Namespace of the metrics written in CloudWatch embedded metric format after every invocation. Defaults to "print2pdf".
+var MetricsNamespace = os.Getenv("METRICS_NAMESPACE")
+
 // Init function checks for required environment variables.
 func init() {
 	if len(os.Args) > 1 && slices.Contains([]string{"-v", "--version"}, os.Args[1]) {
 		fmt.Printf("Version: %s\n", Version)
 		os.Exit(0)
 	}
+	if err := configureLogger(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	if BucketName == "" {
-		fmt.Fprintln(os.Stderr, "missing required environment variable BUCKET")
+		slog.Error("missing required environment variable BUCKET")
+		os.Exit(1)
+	}
+	if err := configureBrowserPool(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := configureNetworkPolicy(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := configureAssets(); err != nil {
+		slog.Error(err.Error())
 		os.Exit(1)
 	}
+	if err := configureCookieDomains(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	configureMetrics()
 }
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		slog.Error(err.Error())
 		os.Exit(1)
 	}
 }
@@ -71,3 +151,117 @@ func run() (err error) {
 
 	return nil
 }
+
+// Configure the browser pool and blocked requests from environment variables.
+func configureBrowserPool() error {
+	if BrowserPoolSize != "" {
+		size, err := strconv.Atoi(BrowserPoolSize)
+		if err != nil {
+			return fmt.Errorf("invalid value for environment variable BROWSER_POOL_SIZE: %s", err)
+		}
+		print2pdf.PoolSize = size
+	}
+	if BrowserMaxTabs != "" {
+		tabs, err := strconv.Atoi(BrowserMaxTabs)
+		if err != nil {
+			return fmt.Errorf("invalid value for environment variable BROWSER_MAX_TABS: %s", err)
+		}
+		print2pdf.MaxTabs = tabs
+	}
+	if BrowserQueueTimeout != "" {
+		timeout, err := time.ParseDuration(BrowserQueueTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid value for environment variable BROWSER_QUEUE_TIMEOUT: %s", err)
+		}
+		print2pdf.QueueTimeout = timeout
+	}
+
+	// Patterns are validated when starting the browser.
+	print2pdf.DefaultBlock = print2pdf.BlockParams{
+		Urls:          splitList(BlockUrls),
+		AllowUrls:     splitList(BlockAllowUrls),
+		ResourceTypes: splitList(BlockResourceTypes),
+	}
+
+	return nil
+}
+
+// Configure the network policy of the browser from environment variables. Requests to private and local networks are
+// denied unless allowed or disabled, and PRINT_ALLOWED_HOSTS is checked again on every redirect.
+func configureNetworkPolicy() error {
+	print2pdf.DenyPrivateNetworks = true
+	if PrintDenyPrivateNetworks != "" {
+		deny, err := strconv.ParseBool(PrintDenyPrivateNetworks)
+		if err != nil {
+			return fmt.Errorf("invalid value for environment variable PRINT_DENY_PRIVATE_NETWORKS: %s", err)
+		}
+		print2pdf.DenyPrivateNetworks = deny
+	}
+	for _, network := range splitList(PrintAllowedNetworks) {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return fmt.Errorf("invalid value for environment variable PRINT_ALLOWED_NETWORKS: %s", err)
+		}
+		print2pdf.AllowedNetworks = append(print2pdf.AllowedNetworks, prefix)
+	}
+	if PrintAllowedHosts != "" && PrintAllowedHosts != "*" {
+		print2pdf.AllowDocumentUrl = checkPrintIsAllowed
+	}
+
+	return nil
+}
+
+// Load the styles and scripts injected in every document from the assets directory, if configured.
+func configureAssets() error {
+	if AssetsDir == "" {
+		return nil
+	}
+
+	styles, scripts, err := print2pdf.LoadAssets(AssetsDir)
+	if err != nil {
+		return fmt.Errorf("error loading assets: %s", err)
+	}
+	print2pdf.DefaultStyles = styles
+	print2pdf.DefaultScripts = scripts
+
+	return nil
+}
+
+// Parse the domains cookies are forwarded to from environment variables.
+func configureCookieDomains() error {
+	for _, pair := range splitList(ForwardCookiesDomains) {
+		name, domain, found := strings.Cut(pair, "=")
+		name, domain = strings.TrimSpace(name), strings.TrimSpace(domain)
+		if !found || name == "" || domain == "" {
+			return fmt.Errorf("invalid value for environment variable FORWARD_COOKIES_DOMAINS: \"%s\" is not a name=domain pair", pair)
+		}
+		cookieDomains[name] = append(cookieDomains[name], domain)
+	}
+
+	return nil
+}
+
+// Configure the default logger, writing JSON to the standard output at the level set by environment variables.
+func configureLogger() error {
+	var level slog.Level
+	if LogLevel != "" {
+		if err := level.UnmarshalText([]byte(LogLevel)); err != nil {
+			return fmt.Errorf("invalid value for environment variable LOG_LEVEL: %s", err)
+		}
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
+
+	return nil
+}
+
+// Split a comma-separated list, trimming spaces and skipping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
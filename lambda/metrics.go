@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Maximum number of values of a metric in a line of embedded metric format.
+const maxEmfValues = 100
+
+// Reader of the metrics recorded by the package, collected after every invocation.
+var metricReader *metric.ManualReader
+
+// Metadata of a line in CloudWatch embedded metric format.
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// Metrics of a line in CloudWatch embedded metric format, with the names of their dimensions.
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+// Definition of a metric in CloudWatch embedded metric format.
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit,omitempty"`
+}
+
+// Configure the meter provider, collecting metrics of each invocation to write them in CloudWatch embedded metric format.
+func configureMetrics() {
+	if MetricsNamespace == "" {
+		MetricsNamespace = "print2pdf"
+	}
+
+	// Counters and histograms are reset after every collection, so each invocation only reports its own measurements.
+	metricReader = metric.NewManualReader(metric.WithTemporalitySelector(func(k metric.InstrumentKind) metricdata.Temporality {
+		switch k {
+		case metric.InstrumentKindUpDownCounter, metric.InstrumentKindObservableUpDownCounter:
+			return metricdata.CumulativeTemporality
+		default:
+			return metricdata.DeltaTemporality
+		}
+	}))
+	otel.SetMeterProvider(metric.NewMeterProvider(metric.WithReader(metricReader)))
+}
+
+// Write the metrics recorded since the previous call to the standard output, in CloudWatch embedded metric format,
+// one line for each set of attributes.
+func emitMetrics(ctx context.Context) {
+	var rm metricdata.ResourceMetrics
+	if err := metricReader.Collect(ctx, &rm); err != nil {
+		slog.ErrorContext(ctx, "error collecting metrics", "error", err)
+
+		return
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					writeEmf(m, dp.Attributes, dp.Value)
+				}
+			case metricdata.Sum[float64]:
+				for _, dp := range data.DataPoints {
+					writeEmf(m, dp.Attributes, dp.Value)
+				}
+			case metricdata.Gauge[int64]:
+				for _, dp := range data.DataPoints {
+					writeEmf(m, dp.Attributes, dp.Value)
+				}
+			case metricdata.Gauge[float64]:
+				for _, dp := range data.DataPoints {
+					writeEmf(m, dp.Attributes, dp.Value)
+				}
+			case metricdata.Histogram[int64]:
+				for _, dp := range data.DataPoints {
+					writeEmf(m, dp.Attributes, histogramValues(float64(dp.Sum), dp.Count))
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					writeEmf(m, dp.Attributes, histogramValues(dp.Sum, dp.Count))
+				}
+			}
+		}
+	}
+}
+
+// Get the values of a histogram to write in embedded metric format. Single measurements, the usual case within an
+// invocation, are exact; otherwise the mean is repeated for each measurement, so that statistics other than
+// percentiles are preserved.
+func histogramValues(sum float64, count uint64) []float64 {
+	if count == 0 {
+		return nil
+	}
+
+	values := make([]float64, min(count, maxEmfValues))
+	for i := range values {
+		values[i] = sum / float64(count)
+	}
+
+	return values
+}
+
+// Write a line in CloudWatch embedded metric format, with the attributes as dimensions.
+func writeEmf(m metricdata.Metrics, attrs attribute.Set, value any) {
+	if v, ok := value.([]float64); ok && len(v) == 0 {
+		return
+	}
+
+	line := map[string]any{}
+	dimensions := []string{}
+	for _, kv := range attrs.ToSlice() {
+		line[string(kv.Key)] = kv.Value.Emit()
+		dimensions = append(dimensions, string(kv.Key))
+	}
+	line[m.Name] = value
+	line["_aws"] = emfMetadata{
+		Timestamp: time.Now().UnixMilli(),
+		CloudWatchMetrics: []emfDirective{{
+			Namespace:  MetricsNamespace,
+			Dimensions: [][]string{dimensions},
+			Metrics:    []emfMetric{{Name: m.Name, Unit: emfUnit(m.Unit)}},
+		}},
+	}
+
+	body, err := json.Marshal(line)
+	if err != nil {
+		slog.Error("error encoding metrics", "metric", m.Name, "error", err)
+
+		return
+	}
+	os.Stdout.Write(append(body, '\n'))
+}
+
+// Units of CloudWatch corresponding to the units of OpenTelemetry used by the package.
+var emfUnits = map[string]string{
+	"s":  "Seconds",
+	"ms": "Milliseconds",
+	"By": "Bytes",
+}
+
+// Get the unit of CloudWatch corresponding to a unit of OpenTelemetry. Annotations, such as "{page}", are counts.
+func emfUnit(unit string) string {
+	if u, ok := emfUnits[unit]; ok {
+		return u
+	}
+	if strings.HasPrefix(unit, "{") {
+		return "Count"
+	}
+
+	return ""
+}
@@ -6,10 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"net/http"
 	"net/url"
-	"os"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/chialab/print2pdf-go/print2pdf"
@@ -40,7 +42,7 @@ func printV1Handler(w http.ResponseWriter, r *http.Request) {
 
 	case "POST":
 		if BucketName == "" {
-			fmt.Fprintln(os.Stderr, "missing required environment variable BUCKET")
+			logger(r.Context()).Error("missing required environment variable BUCKET")
 			jsonError(w, "internal server error", http.StatusInternalServerError)
 
 			return
@@ -67,14 +69,28 @@ func printV2Handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Handle requests to "/v2/merge" endpoint.
+func mergeV2Handler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "OPTIONS":
+		handlePrintOptions(w, r)
+
+	case "POST":
+		handleMergeV2Post(w, r)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 // Handle OPTIONS requests.
 func handlePrintOptions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Methods", "OPTIONS,POST")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", allowedHeaders())
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	origin := r.Header.Get("Origin")
 	if allowOrigin, err := getCorsOriginHeader(origin); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+		logger(r.Context()).Error("error getting CORS allow-origin header value", "error", err)
 		jsonError(w, "internal server error", http.StatusInternalServerError)
 
 		return
@@ -91,7 +107,7 @@ func handlePrintV1Post(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	origin := r.Header.Get("Origin")
 	if allowOrigin, err := getCorsOriginHeader(origin); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+		logger(r.Context()).Error("error getting CORS allow-origin header value", "error", err)
 		jsonError(w, "internal server error", http.StatusInternalServerError)
 
 		return
@@ -101,13 +117,13 @@ func handlePrintV1Post(w http.ResponseWriter, r *http.Request) {
 
 	data, err := readRequest(r)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+		logger(r.Context()).Error("error reading request", "error", err)
 		jsonError(w, "internal server error", http.StatusInternalServerError)
 
 		return
 	}
-	if err := checkPrintIsAllowed(data.Url); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+	if err := checkPrintIsAllowed(data.DocumentUrl()); err != nil {
+		logger(r.Context()).Warn("URL not allowed", "error", err)
 		jsonError(w, "URL is not allowed", http.StatusForbidden)
 
 		return
@@ -115,32 +131,62 @@ func handlePrintV1Post(w http.ResponseWriter, r *http.Request) {
 
 	h, err := print2pdf.NewS3Handler(r.Context(), BucketName, data.FileName)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error creating print handler: %s\n", err)
+		logger(r.Context()).Error("error creating print handler", "error", err)
 		jsonError(w, "internal server error", http.StatusInternalServerError)
 
 		return
 	}
 
-	res, err := print2pdf.PrintPDF(r.Context(), data, h)
+	res, diag, err := print2pdf.PrintPDFWithDiagnostics(r.Context(), data.GetPDFParams, h)
+	logDiagnostics(r.Context(), diag)
 	if ve, ok := err.(print2pdf.ValidationError); ok {
-		fmt.Fprintf(os.Stderr, "request validation error: %s\n", ve)
+		logger(r.Context()).Warn("request validation error", "error", ve)
 		jsonError(w, ve.Error(), http.StatusBadRequest)
 
+		return
+	} else if errors.Is(err, print2pdf.ErrQueueTimeout) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, "server busy, try again later", http.StatusServiceUnavailable)
+
+		return
+	} else if errors.Is(err, print2pdf.ErrWaitTimeout) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, err.Error(), http.StatusGatewayTimeout)
+
+		return
+	} else if denied := new(print2pdf.DeniedRequestError); errors.As(err, denied) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, denied.Error(), http.StatusForbidden)
+
+		return
+	} else if status := new(print2pdf.HttpStatusError); errors.As(err, status) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonResponseError(w, ResponseError{Message: status.Error(), Status: status.StatusCode}, http.StatusBadGateway)
+
+		return
+	} else if exception := new(print2pdf.ExceptionError); errors.As(err, exception) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, exception.Error(), http.StatusBadGateway)
+
 		return
 	} else if errors.Is(r.Context().Err(), context.Canceled) {
-		fmt.Println("connection closed or request canceled")
+		logger(r.Context()).Info("connection closed or request canceled")
 
 		return
 	} else if err != nil {
-		fmt.Fprintf(os.Stderr, "error getting PDF: %s\n", err)
+		logger(r.Context()).Error("error getting PDF", "error", err)
 		jsonError(w, "internal server error", http.StatusInternalServerError)
 
 		return
 	}
 
-	body, err := json.Marshal(ResponseData{Url: res})
+	response := ResponseData{Url: res}
+	if data.Diagnostics {
+		response.Diagnostics = diag
+	}
+	body, err := json.Marshal(response)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error encoding response to JSON: %s\n", err)
+		logger(r.Context()).Error("error encoding response to JSON", "error", err)
 		jsonError(w, "internal server error", http.StatusInternalServerError)
 
 		return
@@ -148,16 +194,15 @@ func handlePrintV1Post(w http.ResponseWriter, r *http.Request) {
 
 	_, err = w.Write(body)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error writing response: %s\n", err)
+		logger(r.Context()).Error("error writing response", "error", err)
 	}
 }
 
 // Handle POST requests to "/v2/print" endpoint.
 func handlePrintV2Post(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/pdf")
 	origin := r.Header.Get("Origin")
 	if allowOrigin, err := getCorsOriginHeader(origin); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+		logger(r.Context()).Error("error getting CORS allow-origin header value", "error", err)
 		jsonError(w, "internal server error", http.StatusInternalServerError)
 
 		return
@@ -168,49 +213,152 @@ func handlePrintV2Post(w http.ResponseWriter, r *http.Request) {
 
 	data, err := readRequest(r)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+		logger(r.Context()).Error("error reading request", "error", err)
 		jsonError(w, "internal server error", http.StatusInternalServerError)
 
 		return
 	}
-	if err := checkPrintIsAllowed(data.Url); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+	if err := checkPrintIsAllowed(data.DocumentUrl()); err != nil {
+		logger(r.Context()).Warn("URL not allowed", "error", err)
 		jsonError(w, "URL is not allowed", http.StatusForbidden)
 
 		return
 	}
 
+	if _, o, err := data.OutputFormat(); err == nil {
+		w.Header().Set("Content-Type", o.ContentType)
+	}
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", data.FileName))
 	h := print2pdf.NewStreamHandler(w)
-	_, err = print2pdf.PrintPDF(r.Context(), data, h)
+	_, diag, err := print2pdf.PrintPDFWithDiagnostics(r.Context(), data.GetPDFParams, h)
+	logDiagnostics(r.Context(), diag)
 	if ve, ok := err.(print2pdf.ValidationError); ok {
-		fmt.Fprintf(os.Stderr, "request validation error: %s\n", ve)
+		logger(r.Context()).Warn("request validation error", "error", ve)
 		jsonError(w, ve.Error(), http.StatusBadRequest)
+	} else if errors.Is(err, print2pdf.ErrQueueTimeout) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, "server busy, try again later", http.StatusServiceUnavailable)
+	} else if errors.Is(err, print2pdf.ErrWaitTimeout) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, err.Error(), http.StatusGatewayTimeout)
+	} else if denied := new(print2pdf.DeniedRequestError); errors.As(err, denied) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, denied.Error(), http.StatusForbidden)
+	} else if status := new(print2pdf.HttpStatusError); errors.As(err, status) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonResponseError(w, ResponseError{Message: status.Error(), Status: status.StatusCode}, http.StatusBadGateway)
+	} else if exception := new(print2pdf.ExceptionError); errors.As(err, exception) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, exception.Error(), http.StatusBadGateway)
 	} else if errors.Is(r.Context().Err(), context.Canceled) {
-		fmt.Println("connection closed or request canceled")
+		logger(r.Context()).Info("connection closed or request canceled")
 	} else if err != nil {
-		fmt.Fprintf(os.Stderr, "error getting PDF: %s\n", err)
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// Handle POST requests to "/v2/merge" endpoint.
+func handleMergeV2Post(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/pdf")
+	origin := r.Header.Get("Origin")
+	if allowOrigin, err := getCorsOriginHeader(origin); err != nil {
+		logger(r.Context()).Error("error getting CORS allow-origin header value", "error", err)
+		jsonError(w, "internal server error", http.StatusInternalServerError)
+
+		return
+	} else if allowOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+	}
+
+	data, err := readMergeRequest(r)
+	if err != nil {
+		logger(r.Context()).Error("error reading request", "error", err)
+		jsonError(w, "internal server error", http.StatusInternalServerError)
+
+		return
+	}
+	for _, part := range data.Parts {
+		if err := checkPrintIsAllowed(part.DocumentUrl()); err != nil {
+			logger(r.Context()).Warn("URL not allowed", "error", err)
+			jsonError(w, "URL is not allowed", http.StatusForbidden)
+
+			return
+		}
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", data.FileName))
+	h := print2pdf.NewStreamHandler(w)
+	_, err = print2pdf.PrintMergedPDF(r.Context(), data, h)
+	if ve, ok := err.(print2pdf.ValidationError); ok {
+		logger(r.Context()).Warn("request validation error", "error", ve)
+		jsonError(w, ve.Error(), http.StatusBadRequest)
+	} else if errors.Is(err, print2pdf.ErrQueueTimeout) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, "server busy, try again later", http.StatusServiceUnavailable)
+	} else if errors.Is(err, print2pdf.ErrWaitTimeout) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, err.Error(), http.StatusGatewayTimeout)
+	} else if denied := new(print2pdf.DeniedRequestError); errors.As(err, denied) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, denied.Error(), http.StatusForbidden)
+	} else if status := new(print2pdf.HttpStatusError); errors.As(err, status) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonResponseError(w, ResponseError{Message: status.Error(), Status: status.StatusCode}, http.StatusBadGateway)
+	} else if exception := new(print2pdf.ExceptionError); errors.As(err, exception) {
+		logger(r.Context()).Error("error getting PDF", "error", err)
+		jsonError(w, exception.Error(), http.StatusBadGateway)
+	} else if errors.Is(r.Context().Err(), context.Canceled) {
+		logger(r.Context()).Info("connection closed or request canceled")
+	} else if err != nil {
+		logger(r.Context()).Error("error getting PDF", "error", err)
 		jsonError(w, "internal server error", http.StatusInternalServerError)
 	}
 }
 
 // Read request parameters in structure.
-func readRequest(r *http.Request) (print2pdf.GetPDFParams, error) {
+func readRequest(r *http.Request) (PrintRequest, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return PrintRequest{}, fmt.Errorf("error reading request data: %s", err)
+	}
+
+	var data PrintRequest
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return PrintRequest{}, fmt.Errorf("error decoding JSON: %s", err)
+	}
+	if _, o, err := data.OutputFormat(); err == nil && !strings.HasSuffix(data.FileName, o.Extension) {
+		data.FileName += o.Extension
+	}
+
+	data.Cookies = extractCookies(r.Cookies())
+	data.Headers = addForwardedHeaders(data.Headers, r.Header.Get)
+	data.Signer = signer
+
+	return data, nil
+}
+
+// Read merge request parameters in structure.
+func readMergeRequest(r *http.Request) (print2pdf.MergePDFParams, error) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		return print2pdf.GetPDFParams{}, fmt.Errorf("error reading request data: %s", err)
+		return print2pdf.MergePDFParams{}, fmt.Errorf("error reading request data: %s", err)
 	}
 
-	var data print2pdf.GetPDFParams
+	var data print2pdf.MergePDFParams
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return print2pdf.GetPDFParams{}, fmt.Errorf("error decoding JSON: %s\noriginal request body: %s", err, string(body))
+		return print2pdf.MergePDFParams{}, fmt.Errorf("error decoding JSON: %s", err)
 	}
 	if !strings.HasSuffix(data.FileName, ".pdf") {
 		data.FileName += ".pdf"
 	}
 
 	data.Cookies = extractCookies(r.Cookies())
+	data.Headers = addForwardedHeaders(data.Headers, r.Header.Get)
+	data.Signer = signer
 
 	return data, nil
 }
@@ -245,11 +393,15 @@ func getCorsOriginHeader(origin string) (string, error) {
 	return "", nil
 }
 
-// checkPrintIsAllowed checks that printing the URL is allowed.
+// checkPrintIsAllowed checks that printing the URL is allowed. When allowed hosts are configured, an empty URL, as for HTML
+// content without a base URL, is never allowed, as the content could load any page.
 func checkPrintIsAllowed(u string) error {
 	if PrintAllowedHosts == "" || PrintAllowedHosts == "*" {
 		return nil
 	}
+	if u == "" {
+		return fmt.Errorf("HTML content without a base URL is not allowed for printing")
+	}
 
 	parsedUrl, err := url.Parse(u)
 	if err != nil {
@@ -267,12 +419,12 @@ func checkPrintIsAllowed(u string) error {
 	return nil
 }
 
-// extractCookies extracts cookies from the request matching the specified names.
+// extractCookies extracts cookies from the request matching the specified names or forwarded to other domains.
 // Parameters:
 // - cookies: the request cookies
 // Returns:
-// - a map with cookie names as keys and their values as map values
-func extractCookies(cookies []*http.Cookie) map[string]string {
+// - the cookies to set for the host of the document and for the configured domains
+func extractCookies(cookies []*http.Cookie) []*print2pdf.Cookie {
 	// Create a lookup map for desired cookie names
 	names := strings.Split(ForwardCookies, ",")
 	wanted := make(map[string]bool)
@@ -281,24 +433,108 @@ func extractCookies(cookies []*http.Cookie) map[string]string {
 	}
 
 	// Collect found cookies
-	found := make(map[string]string)
+	var found []*print2pdf.Cookie
 	for _, c := range cookies {
-		if wanted[c.Name] {
-			found[c.Name] = c.Value
-		}
+		found = append(found, forwardCookie(wanted[c.Name], c.Name, c.Value)...)
 	}
 
 	return found
 }
 
+// forwardCookie creates the cookies to set for a forwarded cookie: one for the host of the document if wanted, and one
+// for each configured domain. Cookies for other domains are sent with cross-site requests, so they must be secure.
+func forwardCookie(wanted bool, name, value string) []*print2pdf.Cookie {
+	var cookies []*print2pdf.Cookie
+	if wanted {
+		cookies = append(cookies, &print2pdf.Cookie{Name: name, Value: print2pdf.Secret(value)})
+	}
+	for _, domain := range cookieDomains[name] {
+		secure := true
+		cookies = append(cookies, &print2pdf.Cookie{
+			Name:     name,
+			Value:    print2pdf.Secret(value),
+			Domain:   domain,
+			Secure:   &secure,
+			SameSite: "none",
+		})
+	}
+
+	return cookies
+}
+
+// Get the value of the Access-Control-Allow-Headers header, including forwarded headers.
+func allowedHeaders() string {
+	return strings.Join(append([]string{"Content-Type"}, forwardedHeaderNames()...), ", ")
+}
+
+// Get the names of the headers to forward.
+func forwardedHeaderNames() []string {
+	var names []string
+	for _, name := range strings.Split(ForwardHeaders, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, http.CanonicalHeaderKey(name))
+		}
+	}
+
+	return names
+}
+
+// addForwardedHeaders adds the request headers matching the forwarded names to the headers, unless already present.
+func addForwardedHeaders(headers map[string]string, get func(name string) string) map[string]string {
+	for _, name := range forwardedHeaderNames() {
+		value := get(name)
+		if value == "" || slices.ContainsFunc(slices.Collect(maps.Keys(headers)), func(n string) bool { return strings.EqualFold(n, name) }) {
+			continue
+		}
+
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[name] = value
+	}
+
+	return headers
+}
+
+// logDiagnostics writes the diagnostics of a page to the logs at debug level.
+func logDiagnostics(ctx context.Context, diag *print2pdf.Diagnostics) {
+	l := logger(ctx)
+	if diag == nil || !l.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	for _, m := range diag.Console {
+		l.Debug("console message", "level", m.Level, "text", m.Text, "url", m.Url, "line", m.Line)
+	}
+	for _, e := range diag.Exceptions {
+		l.Debug("uncaught exception", "message", e.Message, "url", e.Url, "line", e.Line, "column", e.Column)
+	}
+	for _, r := range diag.FailedRequests {
+		l.Debug("failed request", "url", r.Url, "resource_type", r.ResourceType, "error", r.Error, "status", r.Status)
+	}
+	if diag.Dropped > 0 {
+		l.Debug("diagnostics dropped", "count", diag.Dropped)
+	}
+}
+
+// logger gets the logger of a request, carrying its request ID.
+func logger(ctx context.Context) *slog.Logger {
+	return print2pdf.LoggerFromContext(ctx)
+}
+
 // jsonError replies to the request with the specified error message and HTTP code.
 // It does not otherwise end the request; the caller should ensure no further
 // writes are done to w.
 func jsonError(w http.ResponseWriter, message string, code int) {
+	jsonResponseError(w, ResponseError{Message: message}, code)
+}
+
+// jsonResponseError replies to the request with the specified error body and HTTP code, like jsonError.
+func jsonResponseError(w http.ResponseWriter, res ResponseError, code int) {
 	w.Header().Set("Content-Type", "application/json")
-	body, err := json.Marshal(ResponseError{message})
+	body, err := json.Marshal(res)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error encoding error message to JSON: %s\noriginal error: %s\n", err, message)
+		slog.Error("error encoding error message to JSON", "error", err, "original_error", res.Message)
 		body = []byte("internal server error")
 		code = http.StatusInternalServerError
 		w.Header().Set("Content-Type", "text/plain")
@@ -308,6 +544,6 @@ func jsonError(w http.ResponseWriter, message string, code int) {
 	w.WriteHeader(code)
 	_, err = w.Write(body)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error writing error response: %s\noriginal response: %s\n", err, string(body))
+		slog.Error("error writing error response", "error", err, "original_response", string(body))
 	}
 }
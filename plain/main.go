@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,18 +22,33 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 type ResponseData struct {
 	Url string `json:"url"`
+	// Diagnostics of the page, if requested.
+	Diagnostics *print2pdf.Diagnostics `json:"diagnostics,omitempty"`
+}
+
+// Body of print requests, with the options of the server along with print parameters.
+type PrintRequest struct {
+	print2pdf.GetPDFParams
+	// Include diagnostics of the page in the response. Only supported by "/v1/print".
+	Diagnostics bool `json:"diagnostics,omitempty"`
 }
 
 type ResponseError struct {
 	Message string `json:"message"`
+	// HTTP status code of the document, when it responded with an error.
+	Status int `json:"status,omitempty"`
 }
 
 // Version string, set at build time.
@@ -45,9 +66,74 @@ var CorsAllowedHosts = os.Getenv("CORS_ALLOWED_HOSTS")
 // Comma-separated list of cookies to forward when navigating to the URL to be printed.
 var ForwardCookies = os.Getenv("FORWARD_COOKIES")
 
+// Comma-separated list of name=domain pairs of cookies to forward to other domains (e.g. "session=api.example.com").
+var ForwardCookiesDomains = os.Getenv("FORWARD_COOKIES_DOMAINS")
+
+// Domains each cookie is forwarded to, in addition to the host of the document.
+var cookieDomains = map[string][]string{}
+
+// Comma-separated list of headers to forward when navigating to the URL to be printed.
+var ForwardHeaders = os.Getenv("FORWARD_HEADERS")
+
 // Comma-separated list of hosts for which printing is allowed.
 var PrintAllowedHosts = os.Getenv("PRINT_ALLOWED_HOSTS")
 
+// Minimum level of logs, one of "debug", "info", "warn" or "error". Defaults to "info". Diagnostics of printed pages,
+// such as console messages and uncaught exceptions, are logged at debug level.
+var LogLevel = os.Getenv("LOG_LEVEL")
+
+// Whether requests to private and local networks are denied, "true" or "false". Defaults to "true".
+var PrintDenyPrivateNetworks = os.Getenv("PRINT_DENY_PRIVATE_NETWORKS")
+
+// Comma-separated list of networks, in CIDR notation, that can be reached even if they are private or local.
+var PrintAllowedNetworks = os.Getenv("PRINT_ALLOWED_NETWORKS")
+
+// Number of browser processes to start. Defaults to 1.
+var BrowserPoolSize = os.Getenv("BROWSER_POOL_SIZE")
+
+// Maximum number of concurrent tabs for each browser process. Defaults to 10, 0 means no limit.
+var BrowserMaxTabs = os.Getenv("BROWSER_MAX_TABS")
+
+// Maximum time to wait for a free browser tab, as a duration string (e.g. "30s"). Defaults to 30 seconds, 0 means no limit.
+var BrowserQueueTimeout = os.Getenv("BROWSER_QUEUE_TIMEOUT")
+
+// Comma-separated list of URL patterns of requests blocked when loading every document.
+var BlockUrls = os.Getenv("BLOCK_URLS")
+
+// Comma-separated list of URL patterns of requests never blocked, taking precedence over blocked ones.
+var BlockAllowUrls = os.Getenv("BLOCK_ALLOW_URLS")
+
+// Comma-separated list of resource types of requests blocked when loading every document.
+var BlockResourceTypes = os.Getenv("BLOCK_RESOURCE_TYPES")
+
+// Path of a directory with CSS and JavaScript files injected in every document, in alphabetical order.
+var AssetsDir = os.Getenv("ASSETS_DIR")
+
+// Path of the PKCS#12 or PEM file with the certificate used to sign PDFs. Defaults to empty, meaning signatures are disabled.
+var SigningCertificate = os.Getenv("SIGNING_CERTIFICATE")
+
+// Path of the PEM file with the private key used to sign PDFs, if not included in the certificate file.
+var SigningKey = os.Getenv("SIGNING_KEY")
+
+// Password of the PKCS#12 certificate file.
+var SigningPassword = print2pdf.Secret(os.Getenv("SIGNING_PASSWORD"))
+
+// URL of an RFC 3161 timestamp authority used to timestamp signatures. Defaults to empty, meaning no timestamp.
+var SigningTsaUrl = os.Getenv("SIGNING_TSA_URL")
+
+// Path of a PEM file with the root certificates trusted for timestamp tokens. Defaults to empty, meaning the system roots.
+var SigningTsaRoots = os.Getenv("SIGNING_TSA_ROOTS")
+
+// Endpoint of an OpenTelemetry collector receiving traces over OTLP/HTTP (e.g. "http://localhost:4318"). Defaults to
+// empty, meaning traces are not exported.
+var OtlpEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+
+// Endpoint of an OpenTelemetry collector receiving traces over OTLP/HTTP, overriding OtlpEndpoint for traces only.
+var OtlpTracesEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+
+// Signer used for PDFs requesting a signature, loaded at startup.
+var signer *print2pdf.Signer
+
 // Function to shutdown OpenTelemetry.
 var otelShutdown func(context.Context) error
 
@@ -57,21 +143,45 @@ func init() {
 		fmt.Printf("Version: %s\n", Version)
 		os.Exit(0)
 	}
+	if err := configureLogger(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	if Port == "" {
 		Port = "3000"
 	}
+	if err := configureBrowserPool(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := configureNetworkPolicy(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := configureAssets(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := configureCookieDomains(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := configureSigner(); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
 
 	var err error
 	otelShutdown, err = setupOTelSDK()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error initializing OpenTelemetry: %s\n", err)
+		slog.Error("error initializing OpenTelemetry", "error", err)
 		os.Exit(1)
 	}
 }
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		slog.Error(err.Error())
 		os.Exit(1)
 	}
 }
@@ -94,7 +204,7 @@ func run() (err error) {
 	}
 	srvErr := make(chan error, 1)
 	go func() {
-		fmt.Printf("server listening on port %s\n", Port)
+		slog.Info("server listening", "port", Port)
 		srvErr <- srv.ListenAndServe()
 	}()
 
@@ -113,15 +223,193 @@ func run() (err error) {
 	return nil
 }
 
+// Configure the browser pool and blocked requests from environment variables.
+func configureBrowserPool() error {
+	if BrowserPoolSize != "" {
+		size, err := strconv.Atoi(BrowserPoolSize)
+		if err != nil {
+			return fmt.Errorf("invalid value for environment variable BROWSER_POOL_SIZE: %s", err)
+		}
+		print2pdf.PoolSize = size
+	}
+	if BrowserMaxTabs != "" {
+		tabs, err := strconv.Atoi(BrowserMaxTabs)
+		if err != nil {
+			return fmt.Errorf("invalid value for environment variable BROWSER_MAX_TABS: %s", err)
+		}
+		print2pdf.MaxTabs = tabs
+	}
+	if BrowserQueueTimeout != "" {
+		timeout, err := time.ParseDuration(BrowserQueueTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid value for environment variable BROWSER_QUEUE_TIMEOUT: %s", err)
+		}
+		print2pdf.QueueTimeout = timeout
+	}
+
+	// Patterns are validated when starting the browser.
+	print2pdf.DefaultBlock = print2pdf.BlockParams{
+		Urls:          splitList(BlockUrls),
+		AllowUrls:     splitList(BlockAllowUrls),
+		ResourceTypes: splitList(BlockResourceTypes),
+	}
+
+	return nil
+}
+
+// Configure the network policy of the browser from environment variables. Requests to private and local networks are
+// denied unless allowed or disabled, and PRINT_ALLOWED_HOSTS is checked again on every redirect.
+func configureNetworkPolicy() error {
+	print2pdf.DenyPrivateNetworks = true
+	if PrintDenyPrivateNetworks != "" {
+		deny, err := strconv.ParseBool(PrintDenyPrivateNetworks)
+		if err != nil {
+			return fmt.Errorf("invalid value for environment variable PRINT_DENY_PRIVATE_NETWORKS: %s", err)
+		}
+		print2pdf.DenyPrivateNetworks = deny
+	}
+	for _, network := range splitList(PrintAllowedNetworks) {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return fmt.Errorf("invalid value for environment variable PRINT_ALLOWED_NETWORKS: %s", err)
+		}
+		print2pdf.AllowedNetworks = append(print2pdf.AllowedNetworks, prefix)
+	}
+	if PrintAllowedHosts != "" && PrintAllowedHosts != "*" {
+		print2pdf.AllowDocumentUrl = checkPrintIsAllowed
+	}
+
+	return nil
+}
+
+// Load the styles and scripts injected in every document from the assets directory, if configured.
+func configureAssets() error {
+	if AssetsDir == "" {
+		return nil
+	}
+
+	styles, scripts, err := print2pdf.LoadAssets(AssetsDir)
+	if err != nil {
+		return fmt.Errorf("error loading assets: %s", err)
+	}
+	print2pdf.DefaultStyles = styles
+	print2pdf.DefaultScripts = scripts
+
+	return nil
+}
+
+// Parse the domains cookies are forwarded to from environment variables.
+func configureCookieDomains() error {
+	for _, pair := range splitList(ForwardCookiesDomains) {
+		name, domain, found := strings.Cut(pair, "=")
+		name, domain = strings.TrimSpace(name), strings.TrimSpace(domain)
+		if !found || name == "" || domain == "" {
+			return fmt.Errorf("invalid value for environment variable FORWARD_COOKIES_DOMAINS: \"%s\" is not a name=domain pair", pair)
+		}
+		cookieDomains[name] = append(cookieDomains[name], domain)
+	}
+
+	return nil
+}
+
+// Configure the default logger, writing JSON to the standard output at the level set by environment variables.
+func configureLogger() error {
+	var level slog.Level
+	if LogLevel != "" {
+		if err := level.UnmarshalText([]byte(LogLevel)); err != nil {
+			return fmt.Errorf("invalid value for environment variable LOG_LEVEL: %s", err)
+		}
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
+
+	return nil
+}
+
+// Split a comma-separated list, trimming spaces and skipping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// Load the signer from environment variables, if a signing certificate is configured.
+func configureSigner() error {
+	if SigningCertificate == "" {
+		if SigningKey != "" || SigningTsaUrl != "" || SigningTsaRoots != "" {
+			return fmt.Errorf("environment variables SIGNING_KEY, SIGNING_TSA_URL and SIGNING_TSA_ROOTS require SIGNING_CERTIFICATE")
+		}
+
+		return nil
+	}
+
+	data, err := os.ReadFile(SigningCertificate)
+	if err != nil {
+		return fmt.Errorf("error reading signing certificate: %s", err)
+	}
+	if SigningKey != "" {
+		key, err := os.ReadFile(SigningKey)
+		if err != nil {
+			return fmt.Errorf("error reading signing key: %s", err)
+		}
+		data = append(append(data, '\n'), key...)
+	}
+
+	signer, err = print2pdf.LoadSigner(data, SigningPassword)
+	if err != nil {
+		return fmt.Errorf("error loading signing certificate: %s", err)
+	}
+	signer.TimestampUrl = SigningTsaUrl
+	if SigningTsaRoots != "" {
+		roots, err := os.ReadFile(SigningTsaRoots)
+		if err != nil {
+			return fmt.Errorf("error reading timestamp authority roots: %s", err)
+		}
+		signer.TimestampRoots = x509.NewCertPool()
+		if !signer.TimestampRoots.AppendCertsFromPEM(roots) {
+			return fmt.Errorf("error loading timestamp authority roots: no certificates found")
+		}
+	}
+
+	return nil
+}
+
 // Create an HTTP handler instrumented by OpenTelemetry.
 func newHTTPHandler() http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle("/status", http.HandlerFunc(statusHandler))
 	mux.Handle("/v1/print", http.HandlerFunc(printV1Handler))
 	mux.Handle("/v2/print", http.HandlerFunc(printV2Handler))
+	mux.Handle("/v2/merge", http.HandlerFunc(mergeV2Handler))
 	mux.Handle("/metrics", promhttp.Handler())
 
-	return otelhttp.NewHandler(mux, "/")
+	return otelhttp.NewHandler(withRequestID(mux), "/")
+}
+
+// Maximum length of request IDs received in the X-Request-Id header. Longer or invalid ones are replaced.
+const maxRequestIDLength = 128
+
+// Wrap an HTTP handler, adding a logger carrying the request ID to the context of requests. The ID is read from the
+// X-Request-Id header, or generated if missing, and sent back in the response.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if id == "" || len(id) > maxRequestIDLength || strings.ContainsFunc(id, func(c rune) bool { return c < 0x21 || c > 0x7e }) {
+			id = rand.Text()
+		}
+		w.Header().Set("X-Request-Id", id)
+
+		l := slog.Default().With("request_id", id)
+		if sc := oteltrace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			l = l.With("trace_id", sc.TraceID().String())
+		}
+		ctx := print2pdf.ContextWithLogger(r.Context(), l)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
 // Setup OpenTelemetry SDK.
@@ -149,5 +437,25 @@ func setupOTelSDK() (func(context.Context) error, error) {
 	)
 	otel.SetMeterProvider(meterProvider)
 
-	return meterProvider.Shutdown, nil
+	// W3C trace context of incoming requests is propagated to the spans of prints.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if OtlpEndpoint == "" && OtlpTracesEndpoint == "" {
+		return meterProvider.Shutdown, nil
+	}
+
+	// The exporter is configured by the standard OTEL_EXPORTER_OTLP_* environment variables.
+	traceExporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return nil, errors.Join(err, meterProvider.Shutdown(context.Background()))
+	}
+
+	tracerProvider := trace.NewTracerProvider(
+		trace.WithResource(res),
+		trace.WithBatcher(traceExporter),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	return func(ctx context.Context) error {
+		return errors.Join(tracerProvider.Shutdown(ctx), meterProvider.Shutdown(ctx))
+	}, nil
 }
@@ -0,0 +1,184 @@
+package print2pdf
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// A PDF/A conformance level.
+type ArchivalLevel struct {
+	Part        int
+	Conformance string
+}
+
+// Supported PDF/A conformance levels.
+var ArchivalMap = map[string]ArchivalLevel{
+	"pdfa-2b": {2, "B"},
+	"pdfa-3b": {3, "B"},
+}
+
+// Actions that PDF/A documents must not contain.
+var forbiddenActions = []string{
+	"Launch", "Sound", "Movie", "ResetForm", "ImportData", "Hide", "SetOCGState", "Rendition", "Trans", "GoTo3DView", "JavaScript",
+}
+
+// Annotation flags: Invisible, Hidden, Print, NoView and ToggleNoView.
+const (
+	annotFlagInvisible    = 1 << 0
+	annotFlagHidden       = 1 << 1
+	annotFlagPrint        = 1 << 2
+	annotFlagNoView       = 1 << 5
+	annotFlagToggleNoView = 1 << 8
+)
+
+// Get the PDF/A conformance level for the archival option.
+func getArchivalLevel(output, archival string) (*ArchivalLevel, error) {
+	if archival == "" {
+		return nil, nil
+	}
+	if output != "pdf" {
+		return nil, NewValidationError("archival can only be used with pdf output")
+	}
+
+	level, ok := ArchivalMap[archival]
+	if !ok {
+		return nil, NewValidationError(fmt.Sprintf("invalid archival \"%s\", valid archival values are: %s", archival, strings.Join(slices.Sorted(maps.Keys(ArchivalMap)), ", ")))
+	}
+
+	return &level, nil
+}
+
+// Make the document conformant to the PDF/A level, adding an sRGB output intent and removing forbidden features.
+// XMP metadata declaring the conformance must be written separately, see applyMetadata(). A ValidationError is returned
+// if the document cannot be made conformant.
+func applyArchival(ctx *model.Context, level ArchivalLevel) error {
+	if ctx.Encrypt != nil {
+		return NewValidationError(fmt.Sprintf("document cannot be archived as PDF/A-%d%s: encryption is not allowed", level.Part, strings.ToLower(level.Conformance)))
+	}
+
+	root, err := ctx.Catalog()
+	if err != nil {
+		return fmt.Errorf("error reading document catalog: %w", err)
+	}
+
+	var fail error
+	for _, entry := range ctx.Table {
+		if entry == nil || entry.Free || entry.Object == nil {
+			continue
+		}
+
+		walkDicts(entry.Object, func(d types.Dict) {
+			if err := sanitizeArchivalDict(ctx, d); err != nil && fail == nil {
+				fail = err
+			}
+		})
+	}
+	if fail != nil {
+		return NewValidationError(fmt.Sprintf("document cannot be archived as PDF/A-%d%s: %s", level.Part, strings.ToLower(level.Conformance), fail))
+	}
+
+	names, err := ctx.NamesDict()
+	if err != nil {
+		return fmt.Errorf("error reading document names: %w", err)
+	}
+	if names != nil {
+		names.Delete("JavaScript")
+		if level.Part == 2 {
+			// PDF/A-2 only allows embedding PDF/A files, which cannot be guaranteed.
+			names.Delete("EmbeddedFiles")
+		}
+	}
+
+	profile := types.StreamDict{
+		Dict:    types.NewDict(),
+		Content: srgbProfile(),
+	}
+	profile.InsertInt("N", 3)
+	if err := profile.Encode(); err != nil {
+		return err
+	}
+	ir, err := ctx.IndRefForNewObject(profile)
+	if err != nil {
+		return err
+	}
+
+	intent := types.NewDict()
+	intent.InsertName("Type", "OutputIntent")
+	intent.InsertName("S", "GTS_PDFA1")
+	intent.InsertString("OutputConditionIdentifier", srgbDescription)
+	intent.InsertString("Info", srgbDescription)
+	intent.Insert("DestOutputProfile", *ir)
+	root.Update("OutputIntents", types.Array{intent})
+
+	return nil
+}
+
+// Remove features forbidden by PDF/A from a dictionary, and check that fonts are embedded.
+func sanitizeArchivalDict(ctx *model.Context, d types.Dict) error {
+	// Additional actions are always forbidden.
+	d.Delete("AA")
+
+	for _, key := range []string{"A", "OpenAction"} {
+		action, err := ctx.DereferenceDict(d[key])
+		if err != nil || action == nil {
+			continue
+		}
+		if s := action.NameEntry("S"); s != nil && slices.Contains(forbiddenActions, *s) {
+			d.Delete(key)
+		}
+	}
+
+	if b := d.BooleanEntry("Interpolate"); b != nil && *b {
+		d.Update("Interpolate", types.Boolean(false))
+	}
+
+	switch t := d.Type(); {
+	case t != nil && *t == "Annot":
+		flags := 0
+		if f := d.IntEntry("F"); f != nil {
+			flags = *f
+		}
+		flags = (flags | annotFlagPrint) &^ (annotFlagInvisible | annotFlagHidden | annotFlagNoView | annotFlagToggleNoView)
+		d.Update("F", types.Integer(flags))
+
+	case t != nil && *t == "Font":
+		subtype := d.Subtype()
+		if subtype == nil || *subtype == "Type0" || *subtype == "Type3" {
+			// Composite fonts are checked through their descendant fonts, and Type 3 fonts are defined by the document.
+			return nil
+		}
+
+		name := "unknown"
+		if n := d.NameEntry("BaseFont"); n != nil {
+			name = *n
+		}
+		fd, err := ctx.DereferenceDict(d["FontDescriptor"])
+		if err != nil || fd == nil || (fd["FontFile"] == nil && fd["FontFile2"] == nil && fd["FontFile3"] == nil) {
+			return fmt.Errorf("font \"%s\" is not embedded", name)
+		}
+	}
+
+	return nil
+}
+
+// Call a function for each dictionary contained in an object, including nested ones, without following references.
+func walkDicts(o types.Object, fn func(d types.Dict)) {
+	switch o := o.(type) {
+	case types.Dict:
+		fn(o)
+		for _, v := range o {
+			walkDicts(v, fn)
+		}
+	case types.StreamDict:
+		walkDicts(o.Dict, fn)
+	case types.Array:
+		for _, v := range o {
+			walkDicts(v, fn)
+		}
+	}
+}
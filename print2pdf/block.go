@@ -0,0 +1,130 @@
+package print2pdf
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+// Maximum number of URL patterns in each list.
+const maxBlockPatterns = 100
+
+// Resource types of requests that can be blocked. Frames are only blocked in subframes, never in the main one.
+var ResourceTypesMap = map[string]network.ResourceType{
+	"frame":      network.ResourceTypeDocument,
+	"stylesheet": network.ResourceTypeStylesheet,
+	"image":      network.ResourceTypeImage,
+	"media":      network.ResourceTypeMedia,
+	"font":       network.ResourceTypeFont,
+	"script":     network.ResourceTypeScript,
+	"xhr":        network.ResourceTypeXHR,
+	"fetch":      network.ResourceTypeFetch,
+	"other":      network.ResourceTypeOther,
+}
+
+// Requests to block while loading a document, e.g. analytics, ads and chat widgets.
+type BlockParams struct {
+	// Patterns of URLs to block, either globs matching the whole URL where "*" matches any sequence of characters
+	// (e.g. "https://*.doubleclick.net/*"), or regular expressions enclosed in slashes (e.g. "/\\.mp4$/"). Default is empty.
+	Urls []string `json:"urls,omitempty"`
+	// Resource types to block. See ResourceTypesMap for valid values. Default is empty.
+	ResourceTypes []string `json:"resource_types,omitempty"`
+	// Patterns of URLs never blocked, with the same syntax of Urls, taking precedence over Urls and ResourceTypes.
+	// Default is empty.
+	AllowUrls []string `json:"allow_urls,omitempty"`
+}
+
+// Requests blocked for every document, in addition to the ones blocked by each print. Checked by StartBrowser().
+// Default is none.
+var DefaultBlock BlockParams
+
+// Compiled rules deciding which requests are blocked.
+type blocker struct {
+	block []*regexp.Regexp
+	allow []*regexp.Regexp
+	types []network.ResourceType
+}
+
+// Compile the rules of several sets of blocked requests into one.
+func newBlocker(params ...*BlockParams) (*blocker, error) {
+	b := &blocker{}
+	for _, p := range params {
+		if p == nil {
+			continue
+		}
+		if len(p.Urls) > maxBlockPatterns || len(p.AllowUrls) > maxBlockPatterns {
+			return nil, fmt.Errorf("too many URL patterns, maximum is %d", maxBlockPatterns)
+		}
+
+		for _, pattern := range p.Urls {
+			re, err := compileUrlPattern(pattern)
+			if err != nil {
+				return nil, err
+			}
+			b.block = append(b.block, re)
+		}
+		for _, pattern := range p.AllowUrls {
+			re, err := compileUrlPattern(pattern)
+			if err != nil {
+				return nil, err
+			}
+			b.allow = append(b.allow, re)
+		}
+		for _, name := range p.ResourceTypes {
+			t, ok := ResourceTypesMap[name]
+			if !ok {
+				return nil, fmt.Errorf("invalid resource type \"%s\", valid resource types are: %s", name, strings.Join(slices.Sorted(maps.Keys(ResourceTypesMap)), ", "))
+			}
+			if !slices.Contains(b.types, t) {
+				b.types = append(b.types, t)
+			}
+		}
+	}
+
+	return b, nil
+}
+
+// Compile a URL pattern, either a glob or a regular expression enclosed in slashes.
+func compileUrlPattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL pattern \"%s\": %s", pattern, err)
+		}
+
+		return re, nil
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("URL pattern cannot be empty")
+	}
+
+	return regexp.MustCompile("(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"), nil
+}
+
+// Validate blocked requests of a print.
+func validateBlock(b *BlockParams) error {
+	if _, err := newBlocker(b); err != nil {
+		return NewValidationError(fmt.Sprintf("invalid block: %s", err))
+	}
+
+	return nil
+}
+
+// Check if any request may be blocked.
+func (b *blocker) enabled() bool {
+	return len(b.block) > 0 || len(b.types) > 0
+}
+
+// Check if a request must be blocked.
+func (b *blocker) blocks(url string, t network.ResourceType) bool {
+	matches := func(re *regexp.Regexp) bool { return re.MatchString(url) }
+	if slices.ContainsFunc(b.allow, matches) {
+		return false
+	}
+
+	return slices.Contains(b.types, t) || slices.ContainsFunc(b.block, matches)
+}
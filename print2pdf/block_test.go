@@ -0,0 +1,107 @@
+package print2pdf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+func TestValidateBlock(t *testing.T) {
+	tests := []struct {
+		name  string
+		block *BlockParams
+		valid bool
+	}{
+		{"nil", nil, true},
+		{"glob", &BlockParams{Urls: []string{"https://*.doubleclick.net/*"}}, true},
+		{"regular expression", &BlockParams{Urls: []string{`/\.mp4$/`}}, true},
+		{"resource types", &BlockParams{ResourceTypes: []string{"image", "font", "frame"}}, true},
+		{"invalid regular expression", &BlockParams{Urls: []string{"/[a-/"}}, false},
+		{"invalid allowed regular expression", &BlockParams{AllowUrls: []string{"/(/"}}, false},
+		{"empty pattern", &BlockParams{Urls: []string{""}}, false},
+		{"unknown resource type", &BlockParams{ResourceTypes: []string{"websocket"}}, false},
+		{"resource type with wrong case", &BlockParams{ResourceTypes: []string{"Image"}}, false},
+		{"too many patterns", &BlockParams{Urls: strings.Split(strings.Repeat("*,", maxBlockPatterns), ",")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBlock(tt.block)
+			if tt.valid && err != nil {
+				t.Errorf("expected block to be valid, got %s", err)
+			}
+			if !tt.valid {
+				if _, ok := err.(ValidationError); !ok {
+					t.Errorf("expected a validation error, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestBlockerBlocks(t *testing.T) {
+	defaults := &BlockParams{
+		Urls:          []string{"https://*.doubleclick.net/*"},
+		ResourceTypes: []string{"media"},
+		AllowUrls:     []string{"https://cdn.example.com/*"},
+	}
+	request := &BlockParams{
+		Urls:          []string{`/\.woff2?$/`},
+		ResourceTypes: []string{"image"},
+		AllowUrls:     []string{`/^https://example\.com/logo\.png$/`},
+	}
+	b, err := newBlocker(defaults, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		url          string
+		resourceType network.ResourceType
+		blocked      bool
+	}{
+		{"not matching", "https://example.com/style.css", network.ResourceTypeStylesheet, false},
+		{"default glob", "https://ad.doubleclick.net/pixel", network.ResourceTypeScript, true},
+		{"glob is case insensitive", "HTTPS://AD.DOUBLECLICK.NET/pixel", network.ResourceTypeScript, true},
+		{"glob is anchored", "http://example.com/https://ad.doubleclick.net/", network.ResourceTypeScript, false},
+		{"request regular expression", "https://example.com/font.woff2", network.ResourceTypeFont, true},
+		{"default resource type", "https://example.com/video.mp4", network.ResourceTypeMedia, true},
+		{"request resource type", "https://example.com/photo.jpg", network.ResourceTypeImage, true},
+		{"request allow overrides resource type", "https://example.com/logo.png", network.ResourceTypeImage, false},
+		{"default allow overrides request rules", "https://cdn.example.com/font.woff", network.ResourceTypeFont, false},
+		{"default allow overrides resource type", "https://cdn.example.com/photo.jpg", network.ResourceTypeImage, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if blocked := b.blocks(tt.url, tt.resourceType); blocked != tt.blocked {
+				t.Errorf("expected blocked to be %t, got %t", tt.blocked, blocked)
+			}
+		})
+	}
+}
+
+func TestBlockerEnabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  []*BlockParams
+		enabled bool
+	}{
+		{"none", nil, false},
+		{"empty", []*BlockParams{{}, nil}, false},
+		{"only allowed", []*BlockParams{{AllowUrls: []string{"*"}}}, false},
+		{"default urls", []*BlockParams{{Urls: []string{"*.mp4"}}, nil}, true},
+		{"request resource types", []*BlockParams{{}, {ResourceTypes: []string{"font"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := newBlocker(tt.params...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.enabled() != tt.enabled {
+				t.Errorf("expected enabled to be %t", tt.enabled)
+			}
+		})
+	}
+}
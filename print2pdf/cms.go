@@ -0,0 +1,487 @@
+package print2pdf
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Object identifiers used in CMS signatures and timestamps.
+var (
+	oidData                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidTimeStampToken       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSAEncryption        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// Hash functions of the digest algorithms supported in signatures made by others.
+var digestHashes = map[string]crypto.Hash{
+	oidSHA256.String(): crypto.SHA256,
+	oidSHA384.String(): crypto.SHA384,
+	oidSHA512.String(): crypto.SHA512,
+}
+
+// Public key types of the signature algorithms supported in signatures made by others. RSA signatures use PKCS #1 v1.5.
+var signatureAlgorithms = map[string]x509.PublicKeyAlgorithm{
+	oidRSAEncryption.String():   x509.RSA,
+	oidSHA256WithRSA.String():   x509.RSA,
+	oidSHA384WithRSA.String():   x509.RSA,
+	oidSHA512WithRSA.String():   x509.RSA,
+	oidECDSAWithSHA256.String(): x509.ECDSA,
+	oidECDSAWithSHA384.String(): x509.ECDSA,
+	oidECDSAWithSHA512.String(): x509.ECDSA,
+}
+
+// Maximum time to wait for a response of the timestamp authority.
+const timestampTimeout = 30 * time.Second
+
+// Maximum size of a response of the timestamp authority.
+const maxTimestampResponseSize = 1 << 20
+
+// CMS structures, see RFC 5652. Content of ContentInfo is wrapped in an explicit [0] tag, which encoding/asn1 does not
+// apply to raw values, so it is handled manually.
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+	}
+	Certificates asn1.RawValue
+	SignerInfos  []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	Sid                cmsIssuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional"`
+}
+
+type cmsIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// CMS structures as found in signatures made by others, such as timestamp tokens. Certificates and the identifier of
+// the signer are kept raw, as they come in several forms.
+type cmsParsedSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     []byte `asn1:"optional,explicit,tag:0"`
+	}
+	Certificates asn1.RawValue         `asn1:"optional,tag:0"`
+	CRLs         asn1.RawValue         `asn1:"optional,tag:1"`
+	SignerInfos  []cmsParsedSignerInfo `asn1:"set"`
+}
+
+type cmsParsedSignerInfo struct {
+	Version            int
+	Sid                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// ESS signing certificate attribute, see RFC 5035. The hash algorithm is omitted, as it defaults to SHA-256.
+type essSigningCertificateV2 struct {
+	Certs []struct {
+		CertHash []byte
+	}
+}
+
+// Timestamp protocol structures, see RFC 3161.
+type tsaMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tsaRequest struct {
+	Version        int
+	MessageImprint tsaMessageImprint
+	Nonce          *big.Int
+	CertReq        bool
+}
+
+type tsaResponse struct {
+	Status struct {
+		Status       int
+		StatusString []string       `asn1:"optional,utf8"`
+		FailInfo     asn1.BitString `asn1:"optional"`
+	}
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type tsaInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint tsaMessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       struct {
+		Seconds int `asn1:"optional"`
+		Millis  int `asn1:"optional,tag:0"`
+		Micros  int `asn1:"optional,tag:1"`
+	} `asn1:"optional"`
+	Ordering bool     `asn1:"optional"`
+	Nonce    *big.Int `asn1:"optional"`
+}
+
+// Marshal attributes as a DER set, with the given implicit context-specific tag.
+func marshalAttributes(attrs []cmsAttribute, tag byte) ([]byte, error) {
+	der, err := asn1.MarshalWithParams(attrs, "set")
+	if err != nil {
+		return nil, err
+	}
+	der[0] = 0xa0 | tag
+
+	return der, nil
+}
+
+// Create a detached CMS signature of a SHA-256 digest, as required by PAdES baseline signatures. The claimed signing time
+// is written in the signature dictionary, so it is not included as a signed attribute. If the signer has a timestamp
+// authority, a timestamp of the signature is included as an unsigned attribute.
+func createCMSSignature(ctx context.Context, digest []byte, signer *Signer) ([]byte, error) {
+	value := func(v any) asn1.RawValue {
+		der, _ := asn1.Marshal(v)
+
+		return asn1.RawValue{FullBytes: der}
+	}
+
+	certHash := sha256.Sum256(signer.Certificate.Raw)
+	var essCert essSigningCertificateV2
+	essCert.Certs = append(essCert.Certs, struct{ CertHash []byte }{certHash[:]})
+	attrs := []cmsAttribute{
+		{oidContentType, []asn1.RawValue{value(oidData)}},
+		{oidMessageDigest, []asn1.RawValue{value(digest)}},
+		{oidSigningCertificateV2, []asn1.RawValue{value(essCert)}},
+	}
+
+	// The signature is computed over the DER encoding of the attributes as a set, not with their implicit tag.
+	signedAttrs, err := asn1.MarshalWithParams(attrs, "set")
+	if err != nil {
+		return nil, err
+	}
+	attrsDigest := sha256.Sum256(signedAttrs)
+	signature, err := signer.Key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("error computing signature: %w", err)
+	}
+	signedAttrs[0] = 0xa0
+
+	signatureAlgorithm := pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	if _, ok := signer.Key.Public().(*ecdsa.PublicKey); ok {
+		signatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	}
+
+	si := cmsSignerInfo{
+		Version:            1,
+		Sid:                cmsIssuerAndSerialNumber{asn1.RawValue{FullBytes: signer.Certificate.RawIssuer}, signer.Certificate.SerialNumber},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        asn1.RawValue{FullBytes: signedAttrs},
+		SignatureAlgorithm: signatureAlgorithm,
+		Signature:          signature,
+	}
+	if signer.TimestampUrl != "" {
+		token, err := requestTimestamp(ctx, signer.TimestampUrl, signer.TimestampRoots, signature)
+		if err != nil {
+			return nil, err
+		}
+
+		unsignedAttrs, err := marshalAttributes([]cmsAttribute{{oidTimeStampToken, []asn1.RawValue{{FullBytes: token}}}}, 1)
+		if err != nil {
+			return nil, err
+		}
+		si.UnsignedAttrs = asn1.RawValue{FullBytes: unsignedAttrs}
+	}
+
+	certs := [][]byte{signer.Certificate.Raw}
+	for _, cert := range signer.Chain {
+		certs = append(certs, cert.Raw)
+	}
+	slices.SortFunc(certs, bytes.Compare)
+
+	sd := cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: bytes.Join(certs, nil)},
+		SignerInfos:      []cmsSignerInfo{si},
+	}
+	sd.EncapContentInfo.EContentType = oidData
+	content, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+	})
+}
+
+// Request an RFC 3161 timestamp of a signature to a timestamp authority, returning the timestamp token. The token must be
+// signed by a certificate for timestamping trusted by the given roots, or by the system roots if nil.
+func requestTimestamp(ctx context.Context, url string, roots *x509.CertPool, signature []byte) (_ []byte, err error) {
+	ctx, end := startPhase(ctx, "timestamp")
+	defer end(&err)
+
+	imprint := sha256.Sum256(signature)
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req, err := asn1.Marshal(tsaRequest{
+		Version:        1,
+		MessageImprint: tsaMessageImprint{pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, imprint[:]},
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timestampTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(req))
+	if err != nil {
+		return nil, fmt.Errorf("error creating timestamp request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/timestamp-query")
+
+	httpRes, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting timestamp: %w", err)
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error requesting timestamp: timestamp authority responded with status %d", httpRes.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpRes.Body, maxTimestampResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading timestamp response: %w", err)
+	}
+
+	var res tsaResponse
+	if _, err := asn1.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("error decoding timestamp response: %w", err)
+	}
+	// Status is either granted (0) or granted with modifications (1).
+	if res.Status.Status > 1 || len(res.TimeStampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("timestamp request rejected with status %d: %v", res.Status.Status, res.Status.StatusString)
+	}
+
+	sd, err := parseSignedData(res.TimeStampToken.FullBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding timestamp token: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, errors.New("error decoding timestamp token: missing timestamp info")
+	}
+	var info tsaInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, fmt.Errorf("error decoding timestamp token: %w", err)
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || !bytes.Equal(info.MessageImprint.HashedMessage, imprint[:]) ||
+		info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("timestamp token does not match the request")
+	}
+	if err := verifyTimestampToken(sd, info.GenTime, roots); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %w", err)
+	}
+
+	return res.TimeStampToken.FullBytes, nil
+}
+
+// Verify that a timestamp token is signed by a certificate for timestamping, trusted by the given roots at the time of
+// the timestamp. Nil roots mean the system roots.
+func verifyTimestampToken(sd *cmsParsedSignedData, genTime time.Time, roots *x509.CertPool) error {
+	cert, certs, err := verifySignedData(sd, sd.EncapContentInfo.EContent)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageTimeStamping) {
+		return errors.New("certificate of the timestamp authority is not for timestamping")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   genTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return fmt.Errorf("untrusted certificate of the timestamp authority: %w", err)
+	}
+
+	return nil
+}
+
+// Decode a CMS content info holding signed data.
+func parseSignedData(der []byte) (*cmsParsedSignedData, error) {
+	var ci cmsContentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, err
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("unexpected content type %s", ci.ContentType)
+	}
+
+	var sd cmsParsedSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	}
+
+	return &sd, nil
+}
+
+// Decode attributes encoded as a DER set with an implicit context-specific tag.
+func parseAttributes(raw asn1.RawValue) ([]cmsAttribute, error) {
+	der := slices.Clone(raw.FullBytes)
+	if len(der) == 0 {
+		return nil, nil
+	}
+	der[0] = 0x31
+
+	var attrs []cmsAttribute
+	if _, err := asn1.UnmarshalWithParams(der, &attrs, "set"); err != nil {
+		return nil, err
+	}
+
+	return attrs, nil
+}
+
+// Verify the signature of the single signer of a CMS signed data over its signed attributes, which must include the
+// content type and the digest of the given content. Return the certificate of the signer, and all embedded certificates.
+func verifySignedData(sd *cmsParsedSignedData, content []byte) (*x509.Certificate, []*x509.Certificate, error) {
+	if len(sd.SignerInfos) != 1 {
+		return nil, nil, fmt.Errorf("expected a single signer, found %d", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding certificates: %w", err)
+	}
+	cert := signerCertificate(si.Sid, certs)
+	if cert == nil {
+		return nil, nil, errors.New("certificate of the signer not found")
+	}
+
+	hash, ok := digestHashes[si.DigestAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported digest algorithm %s", si.DigestAlgorithm.Algorithm)
+	}
+	attrs, err := parseAttributes(si.SignedAttrs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding signed attributes: %w", err)
+	}
+	var contentType asn1.ObjectIdentifier
+	var digest []byte
+	for _, attr := range attrs {
+		switch {
+		case len(attr.Values) != 1:
+		case attr.Type.Equal(oidContentType):
+			_, err = asn1.Unmarshal(attr.Values[0].FullBytes, &contentType)
+		case attr.Type.Equal(oidMessageDigest):
+			_, err = asn1.Unmarshal(attr.Values[0].FullBytes, &digest)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decoding signed attribute %s: %w", attr.Type, err)
+		}
+	}
+	if !contentType.Equal(sd.EncapContentInfo.EContentType) {
+		return nil, nil, errors.New("content type attribute does not match the content")
+	}
+	h := hash.New()
+	h.Write(content)
+	if !bytes.Equal(digest, h.Sum(nil)) {
+		return nil, nil, errors.New("message digest attribute does not match the content")
+	}
+
+	// The signature is computed over the DER encoding of the attributes as a set, not with their implicit tag.
+	signedAttrs := slices.Clone(si.SignedAttrs.FullBytes)
+	signedAttrs[0] = 0x31
+	h = hash.New()
+	h.Write(signedAttrs)
+	if algorithm := signatureAlgorithms[si.SignatureAlgorithm.Algorithm.String()]; algorithm != cert.PublicKeyAlgorithm {
+		return nil, nil, fmt.Errorf("unsupported signature algorithm %s", si.SignatureAlgorithm.Algorithm)
+	}
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), si.Signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, h.Sum(nil), si.Signature) {
+			err = errors.New("verification error")
+		}
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	return cert, certs, nil
+}
+
+// Find the certificate identified by a CMS signer identifier, either by issuer and serial number or by subject key
+// identifier.
+func signerCertificate(sid asn1.RawValue, certs []*x509.Certificate) *x509.Certificate {
+	var ias cmsIssuerAndSerialNumber
+	_, err := asn1.Unmarshal(sid.FullBytes, &ias)
+	for _, cert := range certs {
+		if err == nil && bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+			return cert
+		}
+		if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 && bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+			return cert
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package print2pdf
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"golang.org/x/net/http/httpguts"
+)
+
+// Maximum number of cookies set for a document.
+const maxCookies = 50
+
+// Map of SameSite attribute values to their DevTools Protocol counterparts.
+var SameSiteMap = map[string]network.CookieSameSite{
+	"strict": network.CookieSameSiteStrict,
+	"lax":    network.CookieSameSiteLax,
+	"none":   network.CookieSameSiteNone,
+}
+
+// A cookie set in the browser before loading a document.
+type Cookie struct {
+	// Name of the cookie. Required.
+	Name string `json:"name"`
+	// Value of the cookie. Never included in logs.
+	Value Secret `json:"value"`
+	// Domain the cookie is sent to, including its subdomains. Default is the host of the document URL, and the cookie
+	// is skipped if the document has no URL.
+	Domain string `json:"domain,omitempty"`
+	// Path the cookie is sent to. Default is "/".
+	Path string `json:"path,omitempty"`
+	// Only send the cookie over HTTPS. Default is true if the document URL is HTTPS, false otherwise.
+	Secure *bool `json:"secure,omitempty"`
+	// Hide the cookie from scripts. Default is true.
+	HttpOnly *bool `json:"http_only,omitempty"`
+	// SameSite attribute. See SameSiteMap for accepted values, "none" requires the cookie to be secure. Default is
+	// decided by Chromium, usually "lax".
+	SameSite string `json:"same_site,omitempty"`
+	// Expiration time. Default is zero, meaning a session cookie, which lasts as long as the tab.
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// Validate cookies set for a document.
+func validateCookies(cookies []*Cookie, documentUrl string) error {
+	if len(cookies) > maxCookies {
+		return NewValidationError(fmt.Sprintf("too many cookies, maximum is %d", maxCookies))
+	}
+
+	https := strings.HasPrefix(strings.ToLower(documentUrl), "https:")
+	for _, c := range cookies {
+		if c == nil || !httpguts.ValidHeaderFieldName(c.Name) {
+			return NewValidationError("invalid cookie name")
+		}
+		if strings.ContainsAny(string(c.Value), ";\"\\") || !httpguts.ValidHeaderFieldValue(string(c.Value)) {
+			return NewValidationError(fmt.Sprintf("invalid value for cookie \"%s\"", c.Name))
+		}
+		if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+			return NewValidationError(fmt.Sprintf("invalid path for cookie \"%s\", must start with a slash", c.Name))
+		}
+		if c.SameSite != "" {
+			if _, ok := SameSiteMap[c.SameSite]; !ok {
+				return NewValidationError(fmt.Sprintf("invalid same_site \"%s\" for cookie \"%s\", valid values are: strict, lax, none", c.SameSite, c.Name))
+			}
+			if c.SameSite == "none" && !(c.Secure == nil && https || c.Secure != nil && *c.Secure) {
+				return NewValidationError(fmt.Sprintf("cookie \"%s\" with same_site none must be secure", c.Name))
+			}
+		}
+	}
+
+	return nil
+}
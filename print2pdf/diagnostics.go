@@ -0,0 +1,208 @@
+package print2pdf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// Maximum number of entries recorded in each list of diagnostics. Further entries are counted in Dropped.
+const maxDiagnostics = 100
+
+// Maximum length in bytes of each recorded message, longer ones are truncated.
+const maxDiagnosticLength = 2000
+
+// What happened in the document while it was loaded and printed, useful to understand why it printed blank or broken.
+type Diagnostics struct {
+	// Messages written to the console, e.g. with console.log().
+	Console []ConsoleMessage `json:"console,omitempty"`
+	// Uncaught JavaScript exceptions, including unhandled promise rejections.
+	Exceptions []Exception `json:"exceptions,omitempty"`
+	// Requests that failed, were blocked, or received an HTTP error status.
+	FailedRequests []FailedRequest `json:"failed_requests,omitempty"`
+	// Number of entries not recorded because a list was full.
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// A message written to the console.
+type ConsoleMessage struct {
+	// Level of the message, e.g. "log", "warning" or "error".
+	Level string `json:"level"`
+	// Text of the message, with arguments separated by spaces.
+	Text string `json:"text"`
+	// URL of the script writing the message, if known.
+	Url string `json:"url,omitempty"`
+	// Line of the script writing the message, starting from 1, if known.
+	Line int64 `json:"line,omitempty"`
+}
+
+// An uncaught JavaScript exception.
+type Exception struct {
+	// Message of the exception, including the stack trace if available.
+	Message string `json:"message"`
+	// URL of the script throwing the exception, if known.
+	Url string `json:"url,omitempty"`
+	// Line of the script throwing the exception, starting from 1.
+	Line int64 `json:"line,omitempty"`
+	// Column of the script throwing the exception, starting from 1.
+	Column int64 `json:"column,omitempty"`
+}
+
+// A request that failed, was blocked, or received an HTTP error status.
+type FailedRequest struct {
+	// URL of the request.
+	Url string `json:"url"`
+	// Resource type of the request, e.g. "document", "script" or "image".
+	ResourceType string `json:"resource_type"`
+	// Network error, e.g. "net::ERR_NAME_NOT_RESOLVED", if the request failed.
+	Error string `json:"error,omitempty"`
+	// HTTP status code, if the request received an error status.
+	Status int64 `json:"status,omitempty"`
+}
+
+// Error returned when the document throws an uncaught exception and FailOnException is set.
+type ExceptionError struct {
+	// The first uncaught exception.
+	Exception Exception
+}
+
+// Implement error interface.
+func (e ExceptionError) Error() string {
+	return fmt.Sprintf("uncaught exception in document: %s", firstLine(e.Exception.Message))
+}
+
+// Recorder of the diagnostics of a document, listening to events of the tab.
+type diagnosticsRecorder struct {
+	mu   sync.Mutex
+	diag Diagnostics
+	urls map[network.RequestID]string // URLs of requests in flight, by request.
+}
+
+// Create a new recorder, listening to events of the tab until the context is done. Must be called before loading the page.
+func newDiagnosticsRecorder(ctx context.Context) *diagnosticsRecorder {
+	r := &diagnosticsRecorder{urls: make(map[network.RequestID]string)}
+
+	chromedp.ListenTarget(ctx, func(ev any) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		switch ev := ev.(type) {
+		case *runtime.EventConsoleAPICalled:
+			args := make([]string, len(ev.Args))
+			for i, arg := range ev.Args {
+				args[i] = formatRemoteObject(arg)
+			}
+			msg := ConsoleMessage{Level: string(ev.Type), Text: truncate(strings.Join(args, " "))}
+			if ev.StackTrace != nil && len(ev.StackTrace.CallFrames) > 0 {
+				msg.Url, msg.Line = ev.StackTrace.CallFrames[0].URL, ev.StackTrace.CallFrames[0].LineNumber+1
+			}
+			r.diag.Console = appendDiagnostic(r, r.diag.Console, msg)
+		case *runtime.EventExceptionThrown:
+			d := ev.ExceptionDetails
+			message := d.Text
+			if d.Exception != nil && d.Exception.Description != "" {
+				message = d.Exception.Description
+			}
+			exc := Exception{Message: truncate(message), Url: d.URL, Line: d.LineNumber + 1, Column: d.ColumnNumber + 1}
+			r.diag.Exceptions = appendDiagnostic(r, r.diag.Exceptions, exc)
+		case *network.EventRequestWillBeSent:
+			r.urls[ev.RequestID] = ev.Request.URL
+		case *network.EventResponseReceived:
+			if ev.Response.Status >= 400 {
+				req := FailedRequest{Url: ev.Response.URL, ResourceType: strings.ToLower(string(ev.Type)), Status: ev.Response.Status}
+				r.diag.FailedRequests = appendDiagnostic(r, r.diag.FailedRequests, req)
+			}
+		case *network.EventLoadingFailed:
+			req := FailedRequest{Url: r.urls[ev.RequestID], ResourceType: strings.ToLower(string(ev.Type)), Error: ev.ErrorText}
+			if ev.BlockedReason != "" {
+				req.Error = fmt.Sprintf("%s (%s)", ev.ErrorText, ev.BlockedReason)
+			}
+			r.diag.FailedRequests = appendDiagnostic(r, r.diag.FailedRequests, req)
+			delete(r.urls, ev.RequestID)
+		case *network.EventLoadingFinished:
+			delete(r.urls, ev.RequestID)
+		}
+	})
+
+	return r
+}
+
+// Append an entry to a list of diagnostics, unless it is full. Must be called with the lock held.
+func appendDiagnostic[T any](r *diagnosticsRecorder, list []T, entry T) []T {
+	if len(list) >= maxDiagnostics {
+		r.diag.Dropped++
+
+		return list
+	}
+
+	return append(list, entry)
+}
+
+// Get a copy of the diagnostics recorded so far.
+func (r *diagnosticsRecorder) diagnostics() *Diagnostics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &Diagnostics{
+		Console:        slices.Clone(r.diag.Console),
+		Exceptions:     slices.Clone(r.diag.Exceptions),
+		FailedRequests: slices.Clone(r.diag.FailedRequests),
+		Dropped:        r.diag.Dropped,
+	}
+}
+
+// Get the error for the first uncaught exception, if any.
+func (r *diagnosticsRecorder) err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.diag.Exceptions) == 0 {
+		return nil
+	}
+
+	return ExceptionError{r.diag.Exceptions[0]}
+}
+
+// Format an argument of a console call as text.
+func formatRemoteObject(o *runtime.RemoteObject) string {
+	if o.Type == runtime.TypeString {
+		var s string
+		if err := json.Unmarshal(o.Value, &s); err == nil {
+			return s
+		}
+	}
+	if o.Description != "" {
+		return o.Description
+	}
+	if len(o.Value) > 0 {
+		return string(o.Value)
+	}
+	if o.UnserializableValue != "" {
+		return string(o.UnserializableValue)
+	}
+
+	return string(o.Type)
+}
+
+// Truncate a message to the maximum length of diagnostics.
+func truncate(s string) string {
+	if len(s) <= maxDiagnosticLength {
+		return s
+	}
+
+	return strings.ToValidUTF8(s[:maxDiagnosticLength], "") + "…"
+}
+
+// Get the first line of a message, e.g. to omit the stack trace of an exception.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+
+	return line
+}
@@ -0,0 +1,183 @@
+package print2pdf
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+	_ "time/tzdata" // Validate timezones regardless of the zoneinfo database of the system.
+
+	chromedpbrowser "github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/emulation"
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/text/language"
+)
+
+// Maximum width and height of the emulated viewport, in CSS pixels.
+const maxViewportSize = 10000
+
+// Maximum emulated device scale factor.
+const maxDeviceScaleFactor = 10
+
+// Device and environment emulated while loading and printing a document.
+type EmulationParams struct {
+	// Viewport width in CSS pixels, affecting the layout of responsive documents. Default is the width of the browser window.
+	Width int64 `json:"width,omitempty"`
+	// Viewport height in CSS pixels. Default is the height of the browser window.
+	Height int64 `json:"height,omitempty"`
+	// Device scale factor, i.e. the ratio between physical and CSS pixels. Default is 1.
+	DeviceScaleFactor float64 `json:"device_scale_factor,omitempty"`
+	// User agent sent with requests and exposed to scripts. Default is the one of the browser.
+	UserAgent string `json:"user_agent,omitempty"`
+	// Locale as a BCP 47 language tag (e.g. "it-IT"), also sent as Accept-Language header. Default is the one of the browser.
+	Locale string `json:"locale,omitempty"`
+	// Timezone as an IANA identifier (e.g. "Europe/Rome"). Default is the one of the browser, usually UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Value of the "prefers-color-scheme" media feature. Accepted values are "light" and "dark". Default is "light".
+	ColorScheme string `json:"color_scheme,omitempty"`
+	// Value of the "prefers-reduced-motion" media feature. Accepted values are "reduce" and "no-preference". Default is
+	// "no-preference".
+	ReducedMotion string `json:"reduced_motion,omitempty"`
+}
+
+// Validate emulation parameters.
+func validateEmulation(e *EmulationParams) error {
+	if e == nil {
+		return nil
+	}
+
+	if e.Width < 0 || e.Width > maxViewportSize || e.Height < 0 || e.Height > maxViewportSize {
+		return NewValidationError(fmt.Sprintf("emulation width and height must be between 0 and %d", maxViewportSize))
+	}
+	if e.DeviceScaleFactor < 0 || e.DeviceScaleFactor > maxDeviceScaleFactor {
+		return NewValidationError(fmt.Sprintf("emulation device_scale_factor must be between 0 and %d", maxDeviceScaleFactor))
+	}
+	if !httpguts.ValidHeaderFieldValue(e.UserAgent) {
+		return NewValidationError("invalid emulation user_agent")
+	}
+	if e.Locale != "" {
+		if _, err := language.Parse(e.Locale); err != nil {
+			return NewValidationError(fmt.Sprintf("invalid emulation locale \"%s\", must be a BCP 47 language tag", e.Locale))
+		}
+	}
+	if e.Timezone != "" {
+		if _, err := time.LoadLocation(e.Timezone); err != nil || e.Timezone == "Local" {
+			return NewValidationError(fmt.Sprintf("invalid emulation timezone \"%s\", must be an IANA timezone identifier", e.Timezone))
+		}
+	}
+	if e.ColorScheme != "" && !slices.Contains([]string{"light", "dark"}, e.ColorScheme) {
+		return NewValidationError(fmt.Sprintf("invalid emulation color_scheme \"%s\", valid values are: light, dark", e.ColorScheme))
+	}
+	if e.ReducedMotion != "" && !slices.Contains([]string{"reduce", "no-preference"}, e.ReducedMotion) {
+		return NewValidationError(fmt.Sprintf("invalid emulation reduced_motion \"%s\", valid values are: reduce, no-preference", e.ReducedMotion))
+	}
+
+	return nil
+}
+
+// Get the media features to emulate, to be passed along with the media type.
+func mediaFeatures(e *EmulationParams) []*emulation.MediaFeature {
+	var features []*emulation.MediaFeature
+	if e != nil && e.ColorScheme != "" {
+		features = append(features, &emulation.MediaFeature{Name: "prefers-color-scheme", Value: e.ColorScheme})
+	}
+	if e != nil && e.ReducedMotion != "" {
+		features = append(features, &emulation.MediaFeature{Name: "prefers-reduced-motion", Value: e.ReducedMotion})
+	}
+
+	return features
+}
+
+// Get the Accept-Language header for a locale, falling back to its base language.
+func acceptLanguage(locale string) string {
+	tag := language.Make(locale)
+	base, _ := tag.Base()
+	if base.String() == tag.String() {
+		return tag.String()
+	}
+
+	return fmt.Sprintf("%s,%s;q=0.9", tag, base)
+}
+
+// Apply emulation in the tab. Must be called before navigating.
+func applyEmulation(ctx context.Context, e *EmulationParams) (err error) {
+	if e == nil {
+		return nil
+	}
+
+	ctx, end := startPhase(ctx, "emulation")
+	defer end(&err)
+
+	if e.Width != 0 || e.Height != 0 || e.DeviceScaleFactor != 0 {
+		if err := emulation.SetDeviceMetricsOverride(e.Width, e.Height, e.DeviceScaleFactor, false).Do(ctx); err != nil {
+			return fmt.Errorf("error emulating viewport: %w", err)
+		}
+	}
+	if e.UserAgent != "" || e.Locale != "" {
+		userAgent := e.UserAgent
+		if userAgent == "" {
+			_, _, _, ua, _, err := chromedpbrowser.GetVersion().Do(ctx)
+			if err != nil {
+				return err
+			}
+			userAgent = ua
+		}
+
+		params := emulation.SetUserAgentOverride(userAgent)
+		if e.Locale != "" {
+			params = params.WithAcceptLanguage(acceptLanguage(e.Locale))
+		}
+		if err := params.Do(ctx); err != nil {
+			return fmt.Errorf("error emulating user agent: %w", err)
+		}
+	}
+	if e.Locale != "" {
+		if err := emulation.SetLocaleOverride().WithLocale(language.Make(e.Locale).String()).Do(ctx); err != nil {
+			return fmt.Errorf("error emulating locale: %w", err)
+		}
+	}
+	if e.Timezone != "" {
+		if err := emulation.SetTimezoneOverride(e.Timezone).Do(ctx); err != nil {
+			return fmt.Errorf("error emulating timezone: %w", err)
+		}
+	}
+	if features := mediaFeatures(e); len(features) > 0 {
+		if err := emulation.SetEmulatedMedia().WithFeatures(features).Do(ctx); err != nil {
+			return fmt.Errorf("error emulating media features: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Remove emulation from the tab, so it does not apply to other documents loaded in the same tab.
+func clearEmulation(ctx context.Context, e *EmulationParams) error {
+	if e == nil {
+		return nil
+	}
+
+	if err := emulation.ClearDeviceMetricsOverride().Do(ctx); err != nil {
+		return err
+	}
+	if e.UserAgent != "" || e.Locale != "" {
+		_, _, _, ua, _, err := chromedpbrowser.GetVersion().Do(ctx)
+		if err != nil {
+			return err
+		}
+		if err := emulation.SetUserAgentOverride(ua).Do(ctx); err != nil {
+			return err
+		}
+	}
+	if e.Locale != "" {
+		if err := emulation.SetLocaleOverride().Do(ctx); err != nil {
+			return err
+		}
+	}
+	if e.Timezone != "" {
+		if err := emulation.SetTimezoneOverride("").Do(ctx); err != nil {
+			return err
+		}
+	}
+
+	return emulation.SetEmulatedMedia().Do(ctx)
+}
@@ -0,0 +1,40 @@
+package print2pdf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateEmulation(t *testing.T) {
+	tests := []struct {
+		name      string
+		emulation *EmulationParams
+		valid     bool
+	}{
+		{"nil", nil, true},
+		{"empty", &EmulationParams{}, true},
+		{"all parameters", &EmulationParams{Width: 1280, Height: 800, DeviceScaleFactor: 2, UserAgent: "print2pdf", Locale: "it-IT", Timezone: "Europe/Rome", ColorScheme: "dark", ReducedMotion: "reduce"}, true},
+		{"UTC timezone", &EmulationParams{Timezone: "UTC"}, true},
+		{"zero width and height, meaning the browser window", &EmulationParams{Width: 0, Height: 0}, true},
+		{"negative width", &EmulationParams{Width: -1}, false},
+		{"negative height", &EmulationParams{Height: -100}, false},
+		{"too wide", &EmulationParams{Width: maxViewportSize + 1}, false},
+		{"negative device scale factor", &EmulationParams{DeviceScaleFactor: -1}, false},
+		{"too large device scale factor", &EmulationParams{DeviceScaleFactor: maxDeviceScaleFactor + 1}, false},
+		{"invalid user agent", &EmulationParams{UserAgent: "print2pdf\r\nX-Injected: 1"}, false},
+		{"invalid locale", &EmulationParams{Locale: "not a locale"}, false},
+		{"invalid timezone", &EmulationParams{Timezone: "Europe/Atlantis"}, false},
+		{"local timezone", &EmulationParams{Timezone: "Local"}, false},
+		{"invalid color scheme", &EmulationParams{ColorScheme: "sepia"}, false},
+		{"invalid reduced motion", &EmulationParams{ReducedMotion: "none"}, false},
+	}
+	for _, tt := range tests {
+		err := validateEmulation(tt.emulation)
+		if tt.valid && err != nil {
+			t.Errorf("validateEmulation() %s error = %v", tt.name, err)
+		}
+		if !tt.valid && !errors.As(err, new(ValidationError)) {
+			t.Errorf("validateEmulation() %s error = %v, want a validation error", tt.name, err)
+		}
+	}
+}
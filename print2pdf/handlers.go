@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // PDFHandler is an interface implementing methods to handle saving a file to a storage location.
@@ -20,6 +24,57 @@ type PDFHandler interface {
 	Handle(io.Reader) (string, error)
 }
 
+// Implemented by handlers of the package that trace their work within the span of the print.
+type contextHandler interface {
+	// Same as Handle(), with the context of the print.
+	handleContext(context.Context, io.Reader) (string, error)
+}
+
+// Error returned by a handler, wrapped to tell it apart from errors of the print.
+type handlerError struct {
+	error
+}
+
+// Get the error returned by the handler.
+func (e handlerError) Unwrap() error {
+	return e.error
+}
+
+// Pass the exported document to a handler, within a span, recording its size.
+func handle(ctx context.Context, h PDFHandler, r io.Reader, output string) (_ string, err error) {
+	ctx, end := startPhase(ctx, "handle", attribute.String("handler", fmt.Sprintf("%T", h)))
+	defer end(&err)
+
+	cr := &countingReader{r: r}
+	var res string
+	if ch, ok := h.(contextHandler); ok {
+		res, err = ch.handleContext(ctx, cr)
+	} else {
+		res, err = h.Handle(cr)
+	}
+	if err != nil {
+		return "", handlerError{err}
+	}
+
+	outputSize.Record(ctx, cr.n, metric.WithAttributes(attribute.String("output", output)))
+
+	return res, nil
+}
+
+// Reader counting the bytes read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Implement io.Reader interface.
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+
+	return n, err
+}
+
 // FileHandler handles saving a file in a local path.
 type FileHandler struct {
 	handle *os.File
@@ -53,20 +108,29 @@ func (fh FileHandler) Handle(r io.Reader) (string, error) {
 
 // S3Handler handles uploading a file to an AWS S3 bucket.
 type S3Handler struct {
-	ctx      context.Context
-	client   *s3.Client
-	bucket   string
-	fileName string
+	ctx         context.Context
+	client      *s3.Client
+	bucket      string
+	fileName    string
+	contentType string
 }
 
-// NewS3Handler returns a new instance of S3Uploader.
+// NewS3Handler returns a new instance of S3Uploader. The content type of the file is detected from the extension
+// of the file name, as in OutputsMap, defaulting to "application/pdf".
 func NewS3Handler(ctx context.Context, bucket, fileName string) (S3Handler, error) {
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return S3Handler{}, fmt.Errorf("error loading AWS SDK configuration: %v", err)
 	}
 
-	return S3Handler{ctx, s3.NewFromConfig(cfg), bucket, fileName}, nil
+	contentType := OutputsMap["pdf"].ContentType
+	for _, o := range OutputsMap {
+		if strings.HasSuffix(strings.ToLower(fileName), o.Extension) {
+			contentType = o.ContentType
+		}
+	}
+
+	return S3Handler{ctx, s3.NewFromConfig(cfg), bucket, fileName, contentType}, nil
 }
 
 // Implement io.Closer interface (noop).
@@ -76,6 +140,14 @@ func (sh S3Handler) Close() error {
 
 // Implement PDFHandler interface.
 func (sh S3Handler) Handle(r io.Reader) (string, error) {
+	return sh.handleContext(sh.ctx, r)
+}
+
+// Upload the file within the span of the context. The upload is still bound to the context of the handler.
+func (sh S3Handler) handleContext(spanCtx context.Context, r io.Reader) (_ string, err error) {
+	ctx, end := startPhase(trace.ContextWithSpan(sh.ctx, trace.SpanFromContext(spanCtx)), "upload", attribute.String("bucket", sh.bucket))
+	defer end(&err)
+
 	uuidv4, err := uuid.NewRandom()
 	if err != nil {
 		return "", fmt.Errorf("error generating UUIDv4: %s", err)
@@ -84,12 +156,12 @@ func (sh S3Handler) Handle(r io.Reader) (string, error) {
 	key := fmt.Sprintf("%s/%s", uuidv4, sh.fileName)
 
 	uploader := manager.NewUploader(sh.client)
-	res, err := uploader.Upload(sh.ctx, &s3.PutObjectInput{
+	res, err := uploader.Upload(ctx, &s3.PutObjectInput{
 		Bucket:             &sh.bucket,
 		Key:                &key,
 		Body:               r,
 		ContentDisposition: Ptr("attachment"),
-		ContentType:        Ptr("application/pdf"),
+		ContentType:        &sh.contentType,
 	})
 	if err != nil {
 		return "", fmt.Errorf("error uploading file: %s", err)
@@ -0,0 +1,101 @@
+package print2pdf
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// Maximum number of extra HTTP headers.
+const maxHeaders = 50
+
+// Headers managed by the browser, which cannot be set as extra HTTP headers.
+var forbiddenHeaders = []string{"connection", "content-length", "host", "keep-alive", "te", "trailer", "transfer-encoding", "upgrade"}
+
+// Credentials for HTTP basic authentication.
+type BasicAuth struct {
+	// Username. Required.
+	Username string `json:"username"`
+	// Password. Default is empty.
+	Password Secret `json:"password,omitempty"`
+}
+
+// Validate extra HTTP headers. Values are never included in errors, as they may contain credentials.
+func validateHeaders(headers map[string]string) error {
+	if len(headers) > maxHeaders {
+		return NewValidationError(fmt.Sprintf("too many headers, maximum is %d", maxHeaders))
+	}
+
+	for name, value := range headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return NewValidationError(fmt.Sprintf("invalid header name \"%s\"", name))
+		}
+		if slices.Contains(forbiddenHeaders, strings.ToLower(name)) || strings.HasPrefix(strings.ToLower(name), "proxy-") {
+			return NewValidationError(fmt.Sprintf("header \"%s\" cannot be set", name))
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return NewValidationError(fmt.Sprintf("invalid value for header \"%s\"", name))
+		}
+	}
+
+	return nil
+}
+
+// Merge two sets of HTTP headers, giving precedence to the second one. Names are compared case-insensitively.
+func mergeHeaders(base, override map[string]string) map[string]string {
+	if len(base) == 0 {
+		return override
+	}
+
+	headers := maps.Clone(override)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	for name, value := range base {
+		if !slices.ContainsFunc(slices.Collect(maps.Keys(headers)), func(n string) bool { return strings.EqualFold(n, name) }) {
+			headers[name] = value
+		}
+	}
+
+	return headers
+}
+
+// Validate basic authentication credentials for the document URL.
+func validateBasicAuth(auth *BasicAuth, documentUrl string) error {
+	if auth == nil {
+		return nil
+	}
+	if auth.Username == "" {
+		return NewValidationError("basic_auth username is required")
+	}
+	if strings.Contains(auth.Username, ":") {
+		return NewValidationError("basic_auth username cannot contain a colon")
+	}
+	if documentUrl == "" {
+		return NewValidationError("basic_auth requires url or base_url")
+	}
+
+	return nil
+}
+
+// Get the origin of a URL as reported by Chromium, omitting the default port of the scheme.
+func urlOrigin(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	host := u.Host
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		host = u.Hostname()
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+	}
+
+	return strings.ToLower(u.Scheme + "://" + host)
+}
@@ -0,0 +1,92 @@
+package print2pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// Description of the sRGB color space, as used by ICC profiles and PDF/A output intents.
+const srgbDescription = "sRGB IEC61966-2.1"
+
+// ICC profile of the sRGB color space, generated once when first needed.
+var srgbProfile = sync.OnceValue(newSRGBProfile)
+
+// Build a version 2 ICC display profile of the sRGB color space, with D50-adapted primaries and a tabulated tone curve.
+func newSRGBProfile() []byte {
+	xyz := func(x, y, z float64) []byte {
+		b := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range []float64{x, y, z} {
+			b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(v*65536))))
+		}
+
+		return b
+	}
+
+	desc := []byte("desc\x00\x00\x00\x00")
+	desc = binary.BigEndian.AppendUint32(desc, uint32(len(srgbDescription)+1))
+	desc = append(desc, srgbDescription+"\x00"...)
+	// Empty Unicode and ScriptCode descriptions.
+	desc = append(desc, make([]byte, 4+4+2+1+67)...)
+
+	trc := []byte("curv\x00\x00\x00\x00")
+	trc = binary.BigEndian.AppendUint32(trc, 1024)
+	for i := range 1024 {
+		v := float64(i) / 1023
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		trc = binary.BigEndian.AppendUint16(trc, uint16(math.Round(v*65535)))
+	}
+
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", desc},
+		{"cprt", []byte("text\x00\x00\x00\x00No copyright, use freely\x00")},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", trc},
+		{"gTRC", trc},
+		{"bTRC", trc},
+	}
+
+	// Tag data follows the header and the tag table, aligned to 4 bytes. Tone curves share the same data.
+	var data bytes.Buffer
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	start := 128 + 4 + 12*len(tags)
+	offsets := map[string]int{}
+	for _, tag := range tags {
+		offset, ok := offsets[string(tag.data)]
+		if !ok {
+			offset = start + data.Len()
+			offsets[string(tag.data)] = offset
+			data.Write(tag.data)
+			data.Write(make([]byte, (4-len(tag.data)%4)%4))
+		}
+
+		table = append(table, tag.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tag.data)))
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(start+data.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntrRGB XYZ ")
+	for i, v := range []uint16{2000, 1, 1, 0, 0, 0} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	copy(header[68:], xyz(0.9642, 1.0, 0.8249)[8:])
+
+	profile := append(header, table...)
+
+	return append(profile, data.Bytes()...)
+}
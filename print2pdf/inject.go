@@ -0,0 +1,141 @@
+package print2pdf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/css"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/runtime"
+)
+
+// Maximum total size in bytes of the styles and scripts injected in a document by a print.
+const maxInjectedSize = 1 << 20
+
+// Maximum time each injected script can run, including the promise it may return.
+const scriptTimeout = 30 * time.Second
+
+// Styles injected in every document, before the ones of each print. Default is empty.
+var DefaultStyles []string
+
+// Scripts run in every document, before the ones of each print. Default is empty.
+var DefaultScripts []string
+
+// Load the styles and scripts of a directory, to be used as DefaultStyles and DefaultScripts. Files with ".css" and
+// ".js" extensions are loaded in alphabetical order, other files and subdirectories are ignored.
+func LoadAssets(dir string) (styles []string, scripts []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".css" && ext != ".js") {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		if ext == ".css" {
+			styles = append(styles, string(content))
+		} else {
+			scripts = append(scripts, string(content))
+		}
+	}
+
+	return styles, scripts, nil
+}
+
+// Validate styles and scripts injected by a print.
+func validateInjections(styles, scripts []string) error {
+	size := 0
+	for _, s := range slices.Concat(styles, scripts) {
+		size += len(s)
+	}
+	if size > maxInjectedSize {
+		return NewValidationError(fmt.Sprintf("styles and scripts are too large, maximum is %d bytes", maxInjectedSize))
+	}
+
+	return nil
+}
+
+// Add styles to the main frame of the loaded document, then run scripts in order. Styles are added as inspector style
+// sheets and scripts are evaluated through the DevTools Protocol, so the Content Security Policy of the page does not
+// apply. Default styles and scripts come first. An exception thrown by a script of the print is returned as a
+// ValidationError.
+func injectAssets(ctx context.Context, defaultStyles, defaultScripts, styles, scripts []string) (err error) {
+	if len(defaultStyles)+len(styles)+len(defaultScripts)+len(scripts) == 0 {
+		return nil
+	}
+
+	ctx, end := startPhase(ctx, "inject")
+	defer end(&err)
+
+	styles = slices.Concat(defaultStyles, styles)
+	if len(styles) > 0 {
+		tree, err := page.GetFrameTree().Do(ctx)
+		if err != nil {
+			return err
+		}
+		for _, style := range styles {
+			id, err := css.CreateStyleSheet(tree.Frame.ID).Do(ctx)
+			if err != nil {
+				return fmt.Errorf("error adding style: %w", err)
+			}
+			if _, err := css.SetStyleSheetText(id, style).Do(ctx); err != nil {
+				return fmt.Errorf("error adding style: %w", err)
+			}
+		}
+	}
+
+	for i, script := range slices.Concat(defaultScripts, scripts) {
+		name := fmt.Sprintf("scripts[%d]", i-len(defaultScripts))
+		if i < len(defaultScripts) {
+			name = fmt.Sprintf("default script %d", i+1)
+		}
+
+		err := runScript(ctx, script)
+		if err != nil && i >= len(defaultScripts) {
+			return NewValidationError(fmt.Sprintf("%s: %s", name, err))
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Run a script in the main frame, waiting for the promise it may return.
+func runScript(ctx context.Context, script string) error {
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+
+	_, exception, err := runtime.Evaluate(script).
+		WithAwaitPromise(true).
+		WithTimeout(runtime.TimeDelta(scriptTimeout.Milliseconds())).
+		Do(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("did not complete within %s", scriptTimeout)
+	} else if err != nil {
+		return err
+	}
+	if exception != nil {
+		message := exception.Text
+		if exception.Exception != nil && exception.Exception.Description != "" {
+			message = exception.Exception.Description
+		}
+
+		return fmt.Errorf("threw an exception: %s", message)
+	}
+
+	return nil
+}
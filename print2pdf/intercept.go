@@ -0,0 +1,245 @@
+package print2pdf
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Interceptor of the requests made by a tab, leveraging the Fetch domain of the DevTools Protocol.
+type interceptor struct {
+	html     string                             // HTML content served in place of the first document.
+	served   atomic.Bool                        // Whether the HTML content has already been served.
+	auth     *BasicAuth                         // Credentials provided when the origin of the document asks for them.
+	headers  map[string]string                  // Extra HTTP headers sent with the requests to the origin of the document.
+	origin   string                             // Origin of the document.
+	attempts sync.Map                           // Requests for which credentials have already been provided.
+	blocker  *blocker                           // Rules of the requests to block.
+	blocked  atomic.Int64                       // Number of blocked requests.
+	policy   *networkPolicy                     // Checker of the requested addresses, if DenyPrivateNetworks is set.
+	allowUrl func(u string) error               // Check of the URLs of the documents of all frames, if any.
+	denied   atomic.Pointer[DeniedRequestError] // First denied request that makes the print fail.
+}
+
+// Create a new interceptor for the provided parameters, applying the policies of the printer.
+func newInterceptor(data GetPDFParams, p *Printer) (*interceptor, error) {
+	b, err := newBlocker(&p.defaultBlock, data.Block)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &interceptor{auth: data.BasicAuth, headers: data.Headers, origin: urlOrigin(data.DocumentUrl()), blocker: b, allowUrl: p.allowDocumentUrl}
+	if data.Html != "" && data.BaseUrl != "" {
+		i.html = data.Html
+	}
+	if p.denyPrivateNetworks {
+		i.policy = &networkPolicy{allowed: p.allowedNetworks}
+	}
+
+	return i, nil
+}
+
+// Check if requests must be intercepted at all.
+func (i *interceptor) enabled() bool {
+	return i.html != "" || i.auth != nil || len(i.headers) > 0 || i.blocker.enabled() || i.policy != nil || i.allowUrl != nil
+}
+
+// Get the patterns of the requests to intercept. Authentication challenges are only reported for intercepted requests.
+func (i *interceptor) patterns() []*fetch.RequestPattern {
+	if i.auth != nil || len(i.headers) > 0 || len(i.blocker.block) > 0 || i.policy != nil {
+		return []*fetch.RequestPattern{{URLPattern: "*"}}
+	}
+
+	var patterns []*fetch.RequestPattern
+	if i.html != "" || i.allowUrl != nil {
+		patterns = append(patterns, &fetch.RequestPattern{URLPattern: "*", ResourceType: network.ResourceTypeDocument})
+	}
+	for _, t := range i.blocker.types {
+		if t != network.ResourceTypeDocument || len(patterns) == 0 {
+			patterns = append(patterns, &fetch.RequestPattern{URLPattern: "*", ResourceType: t})
+		}
+	}
+
+	return patterns
+}
+
+// Start intercepting requests in the tab. Must be called before navigating.
+func (i *interceptor) enable(ctx context.Context) error {
+	if !i.enabled() {
+		return nil
+	}
+
+	mainFrame := cdp.FrameID(chromedp.FromContext(ctx).Target.TargetID)
+	chromedp.ListenTarget(ctx, func(ev any) {
+		switch ev := ev.(type) {
+		case *fetch.EventRequestPaused:
+			// Calls to the browser must not be done in the listener, as they would block the event loop.
+			go func() {
+				if err := i.handleRequest(ctx, ev); err != nil && ctx.Err() == nil {
+					logger(ctx).WarnContext(ctx, "error handling intercepted request", "url", ev.Request.URL, "error", err)
+				}
+			}()
+		case *fetch.EventAuthRequired:
+			go func() {
+				if err := i.handleAuth(ctx, ev); err != nil && ctx.Err() == nil {
+					logger(ctx).WarnContext(ctx, "error handling authentication request", "url", ev.Request.URL, "error", err)
+				}
+			}()
+		case *network.EventResponseReceived:
+			if i.policy != nil {
+				i.handleResponse(ctx, ev, mainFrame)
+			}
+		}
+	})
+
+	if err := fetch.Enable().WithPatterns(i.patterns()).WithHandleAuthRequests(i.auth != nil).Do(ctx); err != nil {
+		return err
+	}
+	if i.policy != nil {
+		return network.SetBlockedURLs(webSocketUrls).Do(ctx)
+	}
+
+	return nil
+}
+
+// Stop intercepting requests in the tab.
+func (i *interceptor) disable(ctx context.Context) error {
+	if !i.enabled() {
+		return nil
+	}
+
+	if i.blocker.enabled() {
+		logger(ctx).InfoContext(ctx, "requests blocked", "count", i.blocked.Load())
+	}
+	if i.policy != nil {
+		if err := network.SetBlockedURLs([]string{}).Do(ctx); err != nil {
+			return err
+		}
+	}
+
+	return fetch.Disable().Do(ctx)
+}
+
+// Decide the fate of a paused request.
+func (i *interceptor) handleRequest(ctx context.Context, ev *fetch.EventRequestPaused) error {
+	if i.html != "" && ev.ResourceType == network.ResourceTypeDocument && i.served.CompareAndSwap(false, true) {
+		return fetch.FulfillRequest(ev.RequestID, 200).
+			WithResponseHeaders([]*fetch.HeaderEntry{{Name: "Content-Type", Value: "text/html; charset=utf-8"}}).
+			WithBody(base64.StdEncoding.EncodeToString([]byte(i.html))).
+			Do(ctx)
+	}
+
+	// The main frame shares its identifier with the target, and its document is never blocked.
+	mainDocument := ev.ResourceType == network.ResourceTypeDocument && string(ev.FrameID) == string(chromedp.FromContext(ctx).Target.TargetID)
+	if ev.ResourceType == network.ResourceTypeDocument && i.allowUrl != nil {
+		if err := i.allowUrl(ev.Request.URL); err != nil {
+			// Denied frames are only logged, while the print fails if the document itself is denied.
+			denied := DeniedRequestError{ev.Request.URL, err.Error()}
+			if mainDocument {
+				i.deny(denied)
+			} else {
+				logger(ctx).WarnContext(ctx, "request denied", "url", denied.Url, "reason", denied.Reason)
+			}
+
+			return fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+		}
+	}
+	if i.policy != nil {
+		if err := i.policy.checkUrl(ctx, ev.Request.URL); err != nil {
+			// Denied subresources are only logged, while the print fails if the document itself is denied.
+			denied := err.(DeniedRequestError)
+			logger(ctx).WarnContext(ctx, "request denied", "url", denied.Url, "reason", denied.Reason)
+			if mainDocument {
+				i.deny(denied)
+			}
+
+			return fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+		}
+	}
+	if !mainDocument && i.blocker.blocks(ev.Request.URL, ev.ResourceType) {
+		i.blocked.Add(1)
+		blockedRequests.Add(ctx, 1, metric.WithAttributes(attribute.String("resource_type", strings.ToLower(string(ev.ResourceType)))))
+
+		return fetch.FailRequest(ev.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+	}
+
+	if len(i.headers) > 0 {
+		return fetch.ContinueRequest(ev.RequestID).WithHeaders(i.requestHeaders(ev)).Do(ctx)
+	}
+
+	return fetch.ContinueRequest(ev.RequestID).Do(ctx)
+}
+
+// Check the remote address of a response again once connected, as the host may resolve differently for the browser.
+// Denied subresources and frames are only logged, while the print fails if the document itself is denied.
+func (i *interceptor) handleResponse(ctx context.Context, ev *network.EventResponseReceived, mainFrame cdp.FrameID) {
+	err := i.policy.checkRemoteAddr(ev.Response.URL, ev.Response.RemoteIPAddress)
+	if err == nil {
+		return
+	}
+
+	denied := err.(DeniedRequestError)
+	logger(ctx).WarnContext(ctx, "request denied", "url", denied.Url, "reason", denied.Reason)
+	if ev.Type == network.ResourceTypeDocument && ev.FrameID == mainFrame {
+		i.deny(denied)
+	}
+}
+
+// Get the headers of a paused request, with the extra HTTP headers only if the request is for the origin of the document.
+// Extra headers carried over by a redirect to another origin are removed.
+func (i *interceptor) requestHeaders(ev *fetch.EventRequestPaused) []*fetch.HeaderEntry {
+	var headers []*fetch.HeaderEntry
+	for name, value := range ev.Request.Headers {
+		if !slices.ContainsFunc(slices.Collect(maps.Keys(i.headers)), func(n string) bool { return strings.EqualFold(n, name) }) {
+			headers = append(headers, &fetch.HeaderEntry{Name: name, Value: fmt.Sprint(value)})
+		}
+	}
+	if i.origin != "" && urlOrigin(ev.Request.URL) == i.origin {
+		for name, value := range i.headers {
+			headers = append(headers, &fetch.HeaderEntry{Name: name, Value: value})
+		}
+	}
+
+	return headers
+}
+
+// Record a denied request making the print fail, keeping the first one.
+func (i *interceptor) deny(err DeniedRequestError) {
+	i.denied.CompareAndSwap(nil, &err)
+}
+
+// Get the error of the first denied request making the print fail, if any.
+func (i *interceptor) err() error {
+	if err := i.denied.Load(); err != nil {
+		return *err
+	}
+
+	return nil
+}
+
+// Answer an authentication challenge, providing credentials only once per request and only to the origin of the document.
+func (i *interceptor) handleAuth(ctx context.Context, ev *fetch.EventAuthRequired) error {
+	res := &fetch.AuthChallengeResponse{Response: fetch.AuthChallengeResponseResponseCancelAuth}
+	_, attempted := i.attempts.LoadOrStore(ev.RequestID, true)
+	if !attempted && ev.AuthChallenge.Source != fetch.AuthChallengeSourceProxy && strings.EqualFold(ev.AuthChallenge.Origin, i.origin) {
+		res = &fetch.AuthChallengeResponse{
+			Response: fetch.AuthChallengeResponseResponseProvideCredentials,
+			Username: i.auth.Username,
+			Password: i.auth.Password.Reveal(),
+		}
+	}
+
+	return fetch.ContinueWithAuth(ev.RequestID, res).Do(ctx)
+}
@@ -0,0 +1,73 @@
+package print2pdf
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+)
+
+func TestRequestHeaders(t *testing.T) {
+	i, err := newInterceptor(GetPDFParams{Url: "https://example.com/page", Headers: map[string]string{"Authorization": "Bearer secret"}}, NewPrinter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		headers  network.Headers
+		expected map[string]string
+	}{
+		{"same origin", "https://example.com/style.css", network.Headers{"Accept": "text/css"}, map[string]string{"Accept": "text/css", "Authorization": "Bearer secret"}},
+		{"same origin with default port", "https://EXAMPLE.com:443/", nil, map[string]string{"Authorization": "Bearer secret"}},
+		{"other host", "https://cdn.example.com/style.css", network.Headers{"Accept": "text/css"}, map[string]string{"Accept": "text/css"}},
+		{"other scheme", "http://example.com/", nil, map[string]string{}},
+		{"redirect to other host", "https://other.com/", network.Headers{"authorization": "Bearer secret"}, map[string]string{}},
+		{"overridden header", "https://example.com/", network.Headers{"authorization": "Bearer other"}, map[string]string{"Authorization": "Bearer secret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := &fetch.EventRequestPaused{Request: &network.Request{URL: tt.url, Headers: tt.headers}}
+			headers := map[string]string{}
+			for _, h := range i.requestHeaders(ev) {
+				headers[h.Name] = h.Value
+			}
+			if !maps.Equal(headers, tt.expected) {
+				t.Errorf("expected headers %v, got %v", tt.expected, headers)
+			}
+		})
+	}
+}
+
+func TestHandleResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		resourceType network.ResourceType
+		frameID      cdp.FrameID
+		remote       string
+		denied       bool
+	}{
+		{"document", network.ResourceTypeDocument, "main", "10.0.0.1", true},
+		{"allowed document", network.ResourceTypeDocument, "main", "93.184.215.14", false},
+		{"frame", network.ResourceTypeDocument, "frame", "10.0.0.1", false},
+		{"image", network.ResourceTypeImage, "main", "169.254.169.254", false},
+		{"font", network.ResourceTypeFont, "main", "127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := &interceptor{policy: &networkPolicy{}}
+			i.handleResponse(context.Background(), &network.EventResponseReceived{
+				Type:     tt.resourceType,
+				FrameID:  tt.frameID,
+				Response: &network.Response{URL: "https://example.com/", RemoteIPAddress: tt.remote},
+			}, "main")
+			if denied := i.err() != nil; denied != tt.denied {
+				t.Errorf("expected print denied to be %t, got %v", tt.denied, i.err())
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package print2pdf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A document to print, with validated parameters.
+type printJob struct {
+	data     GetPDFParams
+	output   string
+	params   page.PrintToPDFParams
+	media    string
+	archival *ArchivalLevel
+	printer  *Printer
+}
+
+// Validate the parameters of a document to print with the printer, applying defaults.
+func (p *Printer) newPrintJob(data GetPDFParams) (printJob, error) {
+	if err := validateSource(data); err != nil {
+		return printJob{}, err
+	}
+	if err := validateWait(data.Wait); err != nil {
+		return printJob{}, err
+	}
+	if err := validateHeaders(data.Headers); err != nil {
+		return printJob{}, err
+	}
+	if err := validateCookies(data.Cookies, data.DocumentUrl()); err != nil {
+		return printJob{}, err
+	}
+	if err := validateBasicAuth(data.BasicAuth, data.DocumentUrl()); err != nil {
+		return printJob{}, err
+	}
+	if err := validateBlock(data.Block); err != nil {
+		return printJob{}, err
+	}
+	if err := validateInjections(data.Styles, data.Scripts); err != nil {
+		return printJob{}, err
+	}
+	if err := validateEmulation(data.Emulation); err != nil {
+		return printJob{}, err
+	}
+	output, _, err := data.OutputFormat()
+	if err != nil {
+		return printJob{}, err
+	}
+	if err := validateScreenshot(output, data.Screenshot); err != nil {
+		return printJob{}, err
+	}
+	if err := validateMetadata(output, data.Metadata); err != nil {
+		return printJob{}, err
+	}
+	if err := validateSecurity(output, data.Security); err != nil {
+		return printJob{}, err
+	}
+	if err := validateWatermark(output, data.Watermark); err != nil {
+		return printJob{}, err
+	}
+	if err := validateSignature(output, data.Signature, data.Signer); err != nil {
+		return printJob{}, err
+	}
+	archival, err := getArchivalLevel(output, data.Archival)
+	if err != nil {
+		return printJob{}, err
+	}
+
+	params, err := getPrintParams(data)
+	if err != nil {
+		return printJob{}, err
+	}
+
+	media := "print"
+	if data.Media != "" {
+		if !slices.Contains([]string{"screen", "print"}, data.Media) {
+			return printJob{}, NewValidationError(fmt.Sprintf("invalid media value \"%s\", valid media values are: screen, print", data.Media))
+		}
+
+		media = data.Media
+	}
+
+	job := printJob{data, output, params, media, archival, p}
+	if err := job.postProcessing().validate(); err != nil {
+		return printJob{}, err
+	}
+
+	return job, nil
+}
+
+// Function receiving the exported document, called within the tab the document was loaded in.
+type exportFunc func(ctx context.Context, r io.Reader) error
+
+// Load the document in the tab, wait for it to be ready, and pass the result to the export function, returning the
+// diagnostics recorded meanwhile, even on error. Listeners registered for the document are removed when done, so the
+// tab can be reused for another document.
+func (j printJob) run(ctx context.Context, export exportFunc) (*Diagnostics, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rec := newDiagnosticsRecorder(ctx)
+	err := j.print(ctx, export, rec)
+
+	return rec.diagnostics(), err
+}
+
+// Print the document in the tab, the actual work of run().
+func (j printJob) print(ctx context.Context, export exportFunc, rec *diagnosticsRecorder) error {
+	icp, err := newInterceptor(j.data, j.printer)
+	if err != nil {
+		return err
+	}
+	if err := icp.enable(ctx); err != nil {
+		return err
+	}
+	if err := j.setCookies(ctx); err != nil {
+		return err
+	}
+	if err := applyEmulation(ctx, j.data.Emulation); err != nil {
+		return err
+	}
+	err = j.load(ctx)
+	if denied := icp.err(); denied != nil {
+		return denied
+	}
+	if err != nil {
+		return err
+	}
+	if err := injectAssets(ctx, j.printer.defaultStyles, j.printer.defaultScripts, j.data.Styles, j.data.Scripts); err != nil {
+		return err
+	}
+	if j.data.FailOnException {
+		if err := rec.err(); err != nil {
+			return err
+		}
+	}
+	if err := j.export(ctx, export); err != nil {
+		return err
+	}
+	if err := clearEmulation(ctx, j.data.Emulation); err != nil {
+		return err
+	}
+
+	return icp.disable(ctx)
+}
+
+// Set cookies in the tab, applying defaults for the document URL. Only names are logged, as values may contain credentials.
+func (j printJob) setCookies(ctx context.Context) (err error) {
+	if len(j.data.Cookies) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(j.data.Cookies))
+	for i, c := range j.data.Cookies {
+		names[i] = c.Name
+	}
+	ctx, end := startPhase(ctx, "cookies", attribute.StringSlice("names", names))
+	defer end(&err)
+
+	u, err := url.Parse(j.data.DocumentUrl())
+	if err != nil {
+		return fmt.Errorf("parsing URL error: %w", err)
+	}
+
+	for _, c := range j.data.Cookies {
+		domain, path, secure, httpOnly := c.Domain, c.Path, u.Scheme == "https", true
+		if domain == "" {
+			domain = u.Hostname()
+		}
+		if domain == "" {
+			continue
+		}
+		if path == "" {
+			path = "/"
+		}
+		if c.Secure != nil {
+			secure = *c.Secure
+		}
+		if c.HttpOnly != nil {
+			httpOnly = *c.HttpOnly
+		}
+
+		params := network.SetCookie(c.Name, string(c.Value)).
+			WithDomain(domain).
+			WithPath(path).
+			WithHTTPOnly(httpOnly).
+			WithSecure(secure)
+		if c.SameSite != "" {
+			params = params.WithSameSite(SameSiteMap[c.SameSite])
+		}
+		if !c.Expires.IsZero() {
+			expires := cdp.TimeSinceEpoch(c.Expires)
+			params = params.WithExpires(&expires)
+		}
+		if err := params.Do(ctx); err != nil {
+			return fmt.Errorf("failed to set cookie %s: %w", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Load the document and wait for the wait conditions to be met, within their deadline.
+func (j printJob) load(ctx context.Context) (err error) {
+	ctx, end := startPhase(ctx, "load")
+	defer end(&err)
+
+	wCtx := ctx
+	if j.data.Wait != nil {
+		var cancel context.CancelFunc
+		wCtx, cancel = context.WithTimeout(ctx, time.Duration(j.data.Wait.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+
+	w := newLoadWatcher(wCtx)
+	loaderID, err := loadDocument(wCtx, j.data)
+	if err == nil {
+		err = w.wait(wCtx, loaderID, j.data.Wait)
+	}
+	if err != nil && errors.Is(wCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("%w within %dms", ErrWaitTimeout, j.data.Wait.Timeout)
+	}
+	if err != nil {
+		return navigationError{err}
+	}
+
+	if res := w.response(loaderID); res != nil && res.Status >= 400 && !j.data.AllowHttpErrors {
+		return HttpStatusError{res.URL, int(res.Status)}
+	}
+
+	return nil
+}
+
+// Error returned when loading the document fails, wrapped to tell it apart from other errors of the print.
+type navigationError struct {
+	error
+}
+
+// Get the error of the navigation.
+func (e navigationError) Unwrap() error {
+	return e.error
+}
+
+// Export the document in the output format, and pass it to the export function.
+func (j printJob) export(ctx context.Context, export exportFunc) (err error) {
+	ctx, end := startPhase(ctx, "export", attribute.String("output", j.output))
+	defer end(&err)
+
+	err = emulation.SetEmulatedMedia().WithMedia(j.media).WithFeatures(mediaFeatures(j.data.Emulation)).Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	if j.output != "pdf" {
+		buf, err := captureScreenshot(ctx, j.output, j.data.Screenshot)
+		if err != nil {
+			return err
+		}
+
+		return export(ctx, bytes.NewReader(buf))
+	}
+
+	_, stream, err := j.params.WithTransferMode(page.PrintToPDFTransferModeReturnAsStream).Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	r := NewStreamHandleReader(ctx, stream)
+	if j.postProcessing().needed() {
+		buf, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if err := r.Close(); err != nil {
+			return err
+		}
+
+		buf, pages, err := j.postProcess(ctx, buf)
+		if err != nil {
+			return err
+		}
+		if err := export(ctx, bytes.NewReader(buf)); err != nil {
+			return err
+		}
+		outputPages.Record(ctx, int64(pages))
+
+		return nil
+	}
+
+	// The document is not parsed when passed through, so pages are counted while it is read.
+	pc := &pageCounter{r: r}
+	if err := export(ctx, pc); err != nil {
+		return err
+	}
+	if err := r.Close(); err != nil {
+		return err
+	}
+	if pages, ok := pc.count(); ok {
+		outputPages.Record(ctx, int64(pages))
+	}
+
+	return nil
+}
+
+// Modifications to apply to the PDF printed by Chromium.
+func (j printJob) postProcessing() postProcessing {
+	return postProcessing{
+		watermark: j.data.Watermark,
+		metadata:  j.data.Metadata,
+		archival:  j.archival,
+		security:  j.data.Security,
+		signature: j.data.Signature,
+		signer:    j.data.Signer,
+	}
+}
+
+// Modify the PDF printed by Chromium, applying the requested changes. The number of pages of the document is returned
+// too, as post-processing does not change it.
+func (j printJob) postProcess(ctx context.Context, buf []byte) (_ []byte, pages int, err error) {
+	ctx, end := startPhase(ctx, "post_process")
+	defer end(&err)
+
+	p := j.postProcessing()
+	if p.metadata != nil || p.archival != nil {
+		// PDF/A requires XMP metadata, which is written along with the requested metadata.
+		m := &PDFMetadata{}
+		if p.metadata != nil {
+			*m = *p.metadata
+		}
+		if m.Title == "" {
+			if err := chromedp.Evaluate(`document.title`, &m.Title).Do(ctx); err != nil {
+				return nil, 0, fmt.Errorf("error getting document title: %w", err)
+			}
+		}
+		p.metadata = m
+	}
+	p.pages = &pages
+	buf, err = p.apply(ctx, buf)
+
+	return buf, pages, err
+}
+
+// Error returned by runInTab() when the browser exits before the result is passed to a handler, meaning it can be retried.
+var errBrowserCrashed = errors.New("browser exited while printing")
+
+// Run a function in a new tab on the least loaded browser of the pool. Cancelling the context will close the tab.
+// If the browser exits before handled is set, meaning the result was not passed to a handler yet, the function is
+// retried once on a restarted browser.
+func (p *browserPool) runInTab(ctx context.Context, fn func(ctx context.Context) error, handled *bool) error {
+	err := p.runInTabOnce(ctx, fn, handled)
+	if errors.Is(err, errBrowserCrashed) {
+		logger(ctx).WarnContext(ctx, "retrying print", "error", err)
+		err = p.runInTabOnce(ctx, fn, handled)
+	}
+
+	return err
+}
+
+// Run a function in a new tab, without retrying.
+func (p *browserPool) runInTabOnce(ctx context.Context, fn func(ctx context.Context) error, handled *bool) error {
+	b, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.release(b)
+
+	err = p.runTab(ctx, b, fn)
+	if err != nil && !*handled && !b.running() && ctx.Err() == nil {
+		return fmt.Errorf("%w: %s", errBrowserCrashed, err)
+	}
+
+	return err
+}
+
+// Run a function in a new tab of the given browser. Cancelling the context will close the tab.
+func runInNewTab(ctx context.Context, b *browser, fn func(ctx context.Context) error) error {
+	tabCtx, tabCancel := chromedp.NewContext(b.ctx, chromedp.WithNewBrowserContext())
+	defer tabCancel()
+	// The tab lives in the context of the browser, so the logger and the span of the print must be carried over.
+	tabCtx = ContextWithLogger(tabCtx, logger(ctx))
+	tabCtx = trace.ContextWithSpan(tabCtx, trace.SpanFromContext(ctx))
+	// Cancel the tab context (closing the tab) if the passed context is canceled.
+	context.AfterFunc(ctx, tabCancel)
+
+	return chromedp.Run(tabCtx, chromedp.ActionFunc(fn))
+}
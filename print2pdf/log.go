@@ -0,0 +1,56 @@
+package print2pdf
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+// Logger used by the package, unless a logger is set in the context with ContextWithLogger() or in the printer with
+// WithLogger(). Default is nil, meaning slog.Default().
+var Logger *slog.Logger
+
+// Key of the logger in a context.
+type loggerKey struct{}
+
+// Return a copy of the context carrying a logger, used by the package for everything done with the context. Useful to
+// add request-scoped attributes, such as a request ID.
+func ContextWithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// Get the logger of a context, falling back to Logger and then to slog.Default().
+func logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && l != nil {
+		return l
+	}
+	if Logger != nil {
+		return Logger
+	}
+
+	return slog.Default()
+}
+
+// Add the attributes identifying a print to the logger of a context.
+func withPrintLogger(ctx context.Context, data GetPDFParams) context.Context {
+	l := logger(ctx)
+	if u, err := url.Parse(data.DocumentUrl()); err == nil && u.Hostname() != "" {
+		l = l.With("url_host", u.Hostname())
+	}
+	if data.FileName != "" {
+		l = l.With("file_name", data.FileName)
+	}
+
+	return ContextWithLogger(ctx, l)
+}
+
+// Get a duration in milliseconds, as logged by the package.
+func durationMs(d time.Duration) slog.Attr {
+	return slog.Float64("duration_ms", float64(d.Microseconds())/1000)
+}
+
+// Get the logger used by the package for a context, to log with the same attributes outside the package.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	return logger(ctx)
+}
@@ -0,0 +1,230 @@
+package print2pdf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Maximum number of documents that can be merged in a single PDF.
+const maxMergeParts = 50
+
+// Parameters for merging several documents in a single PDF.
+type MergePDFParams struct {
+	// Filename of the generated PDF. Required.
+	FileName string `json:"file_name"`
+	// Documents to print, in order. Each one becomes a top-level bookmark of the merged PDF. Required.
+	Parts []MergePart `json:"parts"`
+	// Text or image stamped over the pages of the merged PDF, in addition to watermarks of the parts. Default is nil,
+	// meaning no watermark.
+	Watermark *WatermarkParams `json:"watermark,omitempty"`
+	// Metadata written in the merged PDF. Title defaults to the title of the first part. Default is nil, meaning
+	// metadata of the first part is kept.
+	Metadata *PDFMetadata `json:"metadata,omitempty"`
+	// Encryption and permissions of the merged PDF. Default is nil, meaning no encryption.
+	Security *SecurityParams `json:"security,omitempty"`
+	// PDF/A conformance level of the merged PDF. See ArchivalMap for valid values. Not compatible with Security.
+	// Default is empty, meaning no conformance.
+	Archival string `json:"archival,omitempty"`
+	// Digital signature of the merged PDF. Requires Signer. Not compatible with Security. Default is nil, meaning the
+	// PDF is not signed.
+	Signature *SignatureParams `json:"signature,omitempty"`
+	// Certificate and key used for the signature, usually set from configuration. Default is nil.
+	Signer *Signer `json:"-"`
+	// Extra HTTP headers sent when printing all parts, in addition to headers of the parts, which take precedence.
+	// Default is empty.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Cookies set before loading the documents of all parts, usually forwarded from the incoming request. Default is empty.
+	Cookies []*Cookie `json:"-"`
+}
+
+// A document printed as part of a merged PDF, with its own print parameters. Only the "pdf" output is supported,
+// FileName and Cookies are ignored, and Metadata, Security, Archival and Signature must be set on the merged PDF
+// instead.
+type MergePart struct {
+	// Title of the part's bookmark. Default is the document title, or its URL if the document has no title.
+	Title string `json:"title,omitempty"`
+	GetPDFParams
+}
+
+// Print several webpages, or HTML contents, in a single PDF and write the result to the input handler.
+// All parts are printed sequentially in the same tab. Cancelling the context will close the tab.
+// StartBrowser() must have been called once before calling this function.
+func PrintMergedPDF(ctx context.Context, data MergePDFParams, h PDFHandler) (string, error) {
+	if defaultPrinter == nil {
+		return "", fmt.Errorf("must call StartBrowser() before printing a PDF")
+	}
+
+	return defaultPrinter.PrintMerged(ctx, data, h)
+}
+
+// Print several webpages, or HTML contents, in a single PDF and write the result to the handler. See PrintMergedPDF().
+func (p *Printer) PrintMerged(ctx context.Context, data MergePDFParams, h PDFHandler) (_ string, err error) {
+	pool, err := p.startedPool()
+	if err != nil {
+		return "", err
+	}
+
+	ctx = withPrintLogger(p.withLogger(ctx), GetPDFParams{FileName: data.FileName})
+	ctx, end := startPhase(ctx, "print_merged", attribute.String("file_name", data.FileName), attribute.Int("parts", len(data.Parts)))
+	defer end(&err)
+	start := time.Now()
+	activePrints.Add(ctx, 1)
+	defer activePrints.Add(ctx, -1)
+	defer func() {
+		if err != nil {
+			recordFailure(ctx, err)
+		}
+	}()
+
+	if data.Metadata == nil {
+		data.Metadata = p.defaultParams.Metadata
+	}
+	if data.Security == nil {
+		data.Security = p.defaultParams.Security
+	}
+	if data.Archival == "" {
+		data.Archival = p.defaultParams.Archival
+	}
+	if data.Signature == nil {
+		data.Signature = p.defaultParams.Signature
+	}
+	if data.Signer == nil {
+		data.Signer = p.defaultParams.Signer
+	}
+
+	if len(data.Parts) == 0 {
+		return "", NewValidationError("at least one part is required")
+	}
+	if len(data.Parts) > maxMergeParts {
+		return "", NewValidationError(fmt.Sprintf("too many parts, maximum is %d", maxMergeParts))
+	}
+	if err := validateMetadata("pdf", data.Metadata); err != nil {
+		return "", err
+	}
+	if err := validateSecurity("pdf", data.Security); err != nil {
+		return "", err
+	}
+	if err := validateWatermark("pdf", data.Watermark); err != nil {
+		return "", err
+	}
+	if err := validateSignature("pdf", data.Signature, data.Signer); err != nil {
+		return "", err
+	}
+	archival, err := getArchivalLevel("pdf", data.Archival)
+	if err != nil {
+		return "", err
+	}
+	pp := postProcessing{
+		watermark: data.Watermark,
+		metadata:  data.Metadata,
+		archival:  archival,
+		security:  data.Security,
+		signature: data.Signature,
+		signer:    data.Signer,
+	}
+	if err := pp.validate(); err != nil {
+		return "", err
+	}
+
+	jobs := make([]printJob, len(data.Parts))
+	for i, part := range data.Parts {
+		if part.Output != "" && part.Output != "pdf" {
+			return "", NewValidationError(fmt.Sprintf("parts[%d]: invalid output \"%s\", only pdf is supported", i, part.Output))
+		}
+		if part.Metadata != nil || part.Security != nil || part.Archival != "" || part.Signature != nil {
+			return "", NewValidationError(fmt.Sprintf("parts[%d]: metadata, security, archival and signature are not supported, set them on the merged document", i))
+		}
+
+		part.Cookies = data.Cookies
+		part.Headers = mergeHeaders(data.Headers, part.Headers)
+		job, err := p.newPrintJob(p.withDefaults(part.GetPDFParams, mergedFields...))
+		if ve, ok := err.(ValidationError); ok {
+			return "", NewValidationError(fmt.Sprintf("parts[%d]: %s", i, ve))
+		} else if err != nil {
+			return "", err
+		}
+
+		jobs[i] = job
+	}
+
+	res := ""
+	handled := false
+	err = pool.runInTab(ctx, func(ctx context.Context) error {
+		docs := make([][]byte, len(jobs))
+		titles := make([]string, len(jobs))
+		for i, job := range jobs {
+			_, err := job.run(ctx, func(ctx context.Context, r io.Reader) error {
+				titles[i] = data.Parts[i].Title
+				if titles[i] == "" {
+					if err := chromedp.Evaluate(`document.title`, &titles[i]).Do(ctx); err != nil {
+						return fmt.Errorf("error getting document title: %w", err)
+					}
+				}
+				if titles[i] == "" {
+					titles[i] = job.data.DocumentUrl()
+				}
+				if titles[i] == "" {
+					titles[i] = fmt.Sprintf("Part %d", i+1)
+				}
+
+				var err error
+				docs[i], err = io.ReadAll(r)
+
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("error printing part %d: %w", i+1, err)
+			}
+		}
+
+		merged, err := mergeParts(ctx, docs, titles, pp)
+		if err != nil {
+			return err
+		}
+
+		handled = true
+		res, err = handle(ctx, h, bytes.NewReader(merged), "pdf")
+
+		return err
+	}, &handled)
+	if err != nil {
+		return "", err
+	}
+
+	logger(ctx).InfoContext(ctx, "merged print completed", "parts", len(data.Parts), durationMs(time.Since(start)))
+
+	return res, nil
+}
+
+// Merge the printed parts in a single PDF, then apply the modifications of the merged PDF. Metadata title defaults to
+// the title of the first part.
+func mergeParts(ctx context.Context, docs [][]byte, titles []string, p postProcessing) (_ []byte, err error) {
+	ctx, end := startPhase(ctx, "merge", attribute.Int("parts", len(docs)))
+	defer end(&err)
+
+	merged, err := mergePDFs(docs, titles)
+	if err != nil {
+		return nil, err
+	}
+	if p.metadata != nil || p.archival != nil {
+		m := &PDFMetadata{}
+		if p.metadata != nil {
+			*m = *p.metadata
+		}
+		if m.Title == "" {
+			m.Title = titles[0]
+		}
+		p.metadata = m
+	}
+	if !p.needed() {
+		return merged, nil
+	}
+
+	return p.apply(ctx, merged)
+}
@@ -0,0 +1,206 @@
+package print2pdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Metadata of the generated PDF, written in the document information dictionary and in the XMP metadata.
+type PDFMetadata struct {
+	// Title of the document. Default is the title of the webpage.
+	Title string `json:"title,omitempty"`
+	// Name of the person or organization that created the document. Default is empty.
+	Author string `json:"author,omitempty"`
+	// Subject of the document. Default is empty.
+	Subject string `json:"subject,omitempty"`
+	// Keywords associated with the document. Default is empty.
+	Keywords []string `json:"keywords,omitempty"`
+	// Name of the application that created the original document. Default is empty.
+	Creator string `json:"creator,omitempty"`
+	// Natural language of the document, as a BCP 47 language tag (e.g. "en-US"). Default is empty.
+	Language string `json:"language,omitempty"`
+}
+
+// Maximum length of a single metadata field.
+const maxMetadataLength = 4096
+
+// Current time, used for the dates of the metadata. Replaced in tests.
+var timeNow = time.Now
+
+// Regular expression matching a well-formed BCP 47 language tag.
+var languageTagRegexp = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// Validate metadata for the given output.
+func validateMetadata(output string, m *PDFMetadata) error {
+	if m == nil {
+		return nil
+	}
+	if output != "pdf" {
+		return NewValidationError("metadata can only be used with pdf output")
+	}
+
+	fields := map[string]string{
+		"title":    m.Title,
+		"author":   m.Author,
+		"subject":  m.Subject,
+		"keywords": strings.Join(m.Keywords, ", "),
+		"creator":  m.Creator,
+	}
+	for name, value := range fields {
+		if len(value) > maxMetadataLength {
+			return NewValidationError(fmt.Sprintf("metadata %s is too long, maximum is %d bytes", name, maxMetadataLength))
+		}
+	}
+	if m.Language != "" && !languageTagRegexp.MatchString(m.Language) {
+		return NewValidationError(fmt.Sprintf("invalid metadata language \"%s\", must be a BCP 47 language tag", m.Language))
+	}
+
+	return nil
+}
+
+// Write metadata in the document information dictionary, in the XMP metadata and, for the language, in the catalog.
+// The dates are set to the same values in the information dictionary and in the XMP metadata, and the producer to the
+// one pdfcpu writes. If an archival level is provided, the XMP metadata also declares the PDF/A conformance.
+func applyMetadata(ctx *model.Context, m PDFMetadata, level *ArchivalLevel) error {
+	now := timeNow()
+	producer := "pdfcpu " + model.VersionStr
+
+	if ctx.Info == nil {
+		ir, err := ctx.IndRefForNewObject(types.NewDict())
+		if err != nil {
+			return err
+		}
+		ctx.Info = ir
+	}
+	info, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil {
+		return fmt.Errorf("error reading document information: %w", err)
+	}
+
+	entries := map[string]string{
+		"Title":    m.Title,
+		"Author":   m.Author,
+		"Subject":  m.Subject,
+		"Keywords": strings.Join(m.Keywords, ", "),
+		"Creator":  m.Creator,
+	}
+	for key, value := range entries {
+		if value == "" {
+			info.Delete(key)
+			continue
+		}
+
+		s, err := types.EscapedUTF16String(value)
+		if err != nil {
+			return err
+		}
+		info.Update(key, types.StringLiteral(*s))
+	}
+	info.Update("CreationDate", types.StringLiteral(types.DateString(now)))
+	info.Update("ModDate", types.StringLiteral(types.DateString(now)))
+
+	root, err := ctx.Catalog()
+	if err != nil {
+		return fmt.Errorf("error reading document catalog: %w", err)
+	}
+	if m.Language != "" {
+		root.Update("Lang", types.StringLiteral(m.Language))
+	}
+
+	sd := types.StreamDict{
+		Dict:    types.NewDict(),
+		Content: xmpPacket(m, producer, now, level),
+	}
+	sd.InsertName("Type", "Metadata")
+	sd.InsertName("Subtype", "XML")
+	if err := sd.Encode(); err != nil {
+		return err
+	}
+
+	ir, err := ctx.IndRefForNewObject(sd)
+	if err != nil {
+		return err
+	}
+	root.Update("Metadata", *ir)
+
+	return nil
+}
+
+// Build an XMP packet describing the document.
+func xmpPacket(m PDFMetadata, producer string, date time.Time, level *ArchivalLevel) []byte {
+	esc := func(s string) string {
+		var b bytes.Buffer
+		_ = xml.EscapeText(&b, []byte(s))
+
+		return b.String()
+	}
+	li := func(container string, values ...string) string {
+		var b strings.Builder
+		b.WriteString("<rdf:" + container + ">")
+		for _, v := range values {
+			if container == "Alt" {
+				b.WriteString(`<rdf:li xml:lang="x-default">` + esc(v) + "</rdf:li>")
+			} else {
+				b.WriteString("<rdf:li>" + esc(v) + "</rdf:li>")
+			}
+		}
+		b.WriteString("</rdf:" + container + ">")
+
+		return b.String()
+	}
+
+	var props []string
+	props = append(props, "<dc:format>application/pdf</dc:format>")
+	if m.Title != "" {
+		props = append(props, "<dc:title>"+li("Alt", m.Title)+"</dc:title>")
+	}
+	if m.Author != "" {
+		props = append(props, "<dc:creator>"+li("Seq", m.Author)+"</dc:creator>")
+	}
+	if m.Subject != "" {
+		props = append(props, "<dc:description>"+li("Alt", m.Subject)+"</dc:description>")
+	}
+	if len(m.Keywords) > 0 {
+		props = append(props, "<dc:subject>"+li("Bag", m.Keywords...)+"</dc:subject>")
+		props = append(props, "<pdf:Keywords>"+esc(strings.Join(m.Keywords, ", "))+"</pdf:Keywords>")
+	}
+	if m.Language != "" {
+		props = append(props, "<dc:language>"+li("Bag", m.Language)+"</dc:language>")
+	}
+	if m.Creator != "" {
+		props = append(props, "<xmp:CreatorTool>"+esc(m.Creator)+"</xmp:CreatorTool>")
+	}
+	d := date.Format(time.RFC3339)
+	props = append(props,
+		"<pdf:Producer>"+esc(producer)+"</pdf:Producer>",
+		"<xmp:CreateDate>"+d+"</xmp:CreateDate>",
+		"<xmp:ModifyDate>"+d+"</xmp:ModifyDate>",
+		"<xmp:MetadataDate>"+d+"</xmp:MetadataDate>",
+	)
+	if level != nil {
+		props = append(props,
+			fmt.Sprintf("<pdfaid:part>%d</pdfaid:part>", level.Part),
+			"<pdfaid:conformance>"+level.Conformance+"</pdfaid:conformance>",
+		)
+	}
+
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	b.WriteString(`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">` + "\n")
+	for _, p := range props {
+		b.WriteString(p + "\n")
+	}
+	b.WriteString("</rdf:Description>\n</rdf:RDF>\n</x:xmpmeta>\n")
+	b.WriteString(`<?xpacket end="w"?>`)
+
+	return []byte(b.String())
+}
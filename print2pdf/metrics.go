@@ -0,0 +1,176 @@
+package print2pdf
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Meter used to record the package's metrics. Exported through the global OpenTelemetry meter provider.
+var meter = otel.Meter("github.com/chialab/print2pdf-go/print2pdf")
+
+// Number of requests blocked while loading documents.
+var blockedRequests metric.Int64Counter
+
+// Duration of each phase of prints.
+var phaseDuration metric.Float64Histogram
+
+// Size of the documents passed to handlers.
+var outputSize metric.Int64Histogram
+
+// Number of pages of printed PDF documents.
+var outputPages metric.Int64Histogram
+
+// Number of failed prints, by reason.
+var failedPrints metric.Int64Counter
+
+// Number of prints in progress.
+var activePrints metric.Int64UpDownCounter
+
+// Number of browsers restarted after exiting.
+var browserRestarts metric.Int64Counter
+
+// Printers started and not yet closed, whose pools are reported by the observable instruments.
+var startedPrinters sync.Map
+
+// Register observable instruments reporting the state of the browser pools.
+func init() {
+	browsersGauge, err := meter.Int64ObservableGauge(
+		"print2pdf.pool.browsers",
+		metric.WithDescription("Number of running browser processes in the pool."),
+		metric.WithUnit("{browser}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	tabsGauge, err := meter.Int64ObservableGauge(
+		"print2pdf.pool.tabs",
+		metric.WithDescription("Number of browser tabs currently in use."),
+		metric.WithUnit("{tab}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	queueGauge, err := meter.Int64ObservableGauge(
+		"print2pdf.pool.queue.depth",
+		metric.WithDescription("Number of prints waiting for a free browser tab."),
+		metric.WithUnit("{print}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		var browsers, tabs, waiting int
+		startedPrinters.Range(func(key, _ any) bool {
+			b, t, w := key.(*Printer).stats()
+			browsers, tabs, waiting = browsers+b, tabs+t, waiting+w
+
+			return true
+		})
+		o.ObserveInt64(browsersGauge, int64(browsers))
+		o.ObserveInt64(tabsGauge, int64(tabs))
+		o.ObserveInt64(queueGauge, int64(waiting))
+
+		return nil
+	}, browsersGauge, tabsGauge, queueGauge)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	blockedRequests, err = meter.Int64Counter(
+		"print2pdf.requests.blocked",
+		metric.WithDescription("Number of requests blocked while loading documents."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	phaseDuration, err = meter.Float64Histogram(
+		"print2pdf.phase.duration",
+		metric.WithDescription("Duration of each phase of prints."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	outputSize, err = meter.Int64Histogram(
+		"print2pdf.output.size",
+		metric.WithDescription("Size of the documents passed to handlers."),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(1<<10, 10<<10, 100<<10, 500<<10, 1<<20, 5<<20, 10<<20, 50<<20, 100<<20),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	outputPages, err = meter.Int64Histogram(
+		"print2pdf.output.pages",
+		metric.WithDescription("Number of pages of printed PDF documents."),
+		metric.WithUnit("{page}"),
+		metric.WithExplicitBucketBoundaries(1, 2, 5, 10, 20, 50, 100, 200, 500, 1000),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	failedPrints, err = meter.Int64Counter(
+		"print2pdf.prints.failed",
+		metric.WithDescription("Number of failed prints, by reason: validation, navigation, timeout, handler or browser."),
+		metric.WithUnit("{print}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	activePrints, err = meter.Int64UpDownCounter(
+		"print2pdf.prints.active",
+		metric.WithDescription("Number of prints in progress, including the ones waiting for a free browser tab."),
+		metric.WithUnit("{print}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	browserRestarts, err = meter.Int64Counter(
+		"print2pdf.browser.restarts",
+		metric.WithDescription("Number of browsers restarted after exiting."),
+		metric.WithUnit("{restart}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// Record the failure of a print, unless it was canceled by the caller.
+func recordFailure(ctx context.Context, err error) {
+	if reason := failureReason(err); reason != "" {
+		failedPrints.Add(ctx, 1, metric.WithAttributes(attribute.String("reason", reason)))
+	}
+}
+
+// Get the reason of the failure of a print, as recorded in metrics. Empty if the print was canceled by the caller.
+func failureReason(err error) string {
+	switch {
+	case errors.As(err, new(ValidationError)):
+		return "validation"
+	case errors.Is(err, ErrQueueTimeout), errors.Is(err, ErrWaitTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return ""
+	case errors.As(err, new(handlerError)):
+		return "handler"
+	case errors.As(err, new(navigationError)), errors.As(err, new(DeniedRequestError)), errors.As(err, new(HttpStatusError)),
+		errors.As(err, new(ExceptionError)):
+		return "navigation"
+	default:
+		return "browser"
+	}
+}
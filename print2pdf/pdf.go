@@ -0,0 +1,287 @@
+package print2pdf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Prevent pdfcpu from creating its configuration directory in the user's home.
+func init() {
+	api.DisableConfigDir()
+}
+
+// Create a new configuration for processing PDF files generated by Chromium.
+func newPDFConfiguration() *model.Configuration {
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+
+	return conf
+}
+
+// Merge PDF documents in a single one, adding a top-level bookmark with the given title for each document.
+func mergePDFs(docs [][]byte, titles []string) ([]byte, error) {
+	bookmarks := make([]pdfcpu.Bookmark, 0, len(docs))
+	readers := make([]io.ReadSeeker, 0, len(docs))
+	page := 1
+	for i, doc := range docs {
+		count, err := api.PageCount(bytes.NewReader(doc), newPDFConfiguration())
+		if err != nil {
+			return nil, fmt.Errorf("error counting pages of document %d: %w", i+1, err)
+		}
+
+		bookmarks = append(bookmarks, pdfcpu.Bookmark{Title: titles[i], PageFrom: page})
+		readers = append(readers, bytes.NewReader(doc))
+		page += count
+	}
+
+	var merged bytes.Buffer
+	if err := api.MergeRaw(readers, &merged, false, newPDFConfiguration()); err != nil {
+		return nil, fmt.Errorf("error merging documents: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := api.AddBookmarks(bytes.NewReader(merged.Bytes()), &out, bookmarks, true, newPDFConfiguration()); err != nil {
+		return nil, fmt.Errorf("error adding bookmarks: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// A modification applied to a PDF document.
+type pdfStep func(ctx *model.Context) error
+
+// Modifications to apply to a PDF document after printing.
+type postProcessing struct {
+	watermark *WatermarkParams
+	metadata  *PDFMetadata // Must be provided if archival is.
+	archival  *ArchivalLevel
+	security  *SecurityParams
+	signature *SignatureParams
+	signer    *Signer // Must be provided if signature is.
+	pages     *int    // Set to the number of pages of the document, if provided.
+}
+
+// Check that the modifications are compatible with each other.
+func (p postProcessing) validate() error {
+	if p.security != nil && p.signature != nil {
+		return NewValidationError("security cannot be used with signature")
+	}
+	if p.archival == nil {
+		return nil
+	}
+	if p.security != nil {
+		return NewValidationError("security cannot be used with archival, as PDF/A does not allow encryption")
+	}
+	if p.watermark != nil && p.watermark.Text != "" {
+		return NewValidationError("text watermark cannot be used with archival, as its font cannot be embedded")
+	}
+	if p.signature != nil && p.signature.Box != nil {
+		return NewValidationError("visible signature cannot be used with archival, as its font cannot be embedded")
+	}
+
+	return nil
+}
+
+// Check if there is any modification to apply.
+func (p postProcessing) needed() bool {
+	return p.watermark != nil || p.metadata != nil || p.archival != nil || p.security != nil || p.signature != nil
+}
+
+// Get the modifications to apply, in the order they must be applied.
+func (p postProcessing) steps() []pdfStep {
+	var steps []pdfStep
+	if p.pages != nil {
+		steps = append(steps, func(ctx *model.Context) error { *p.pages = ctx.PageCount; return nil })
+	}
+	if p.watermark != nil {
+		steps = append(steps, func(ctx *model.Context) error { return applyWatermark(ctx, *p.watermark) })
+	}
+	if p.archival != nil {
+		steps = append(steps, func(ctx *model.Context) error { return applyArchival(ctx, *p.archival) })
+	}
+	if p.metadata != nil {
+		steps = append(steps, func(ctx *model.Context) error { return applyMetadata(ctx, *p.metadata, p.archival) })
+	}
+	if p.security != nil {
+		steps = append(steps, func(ctx *model.Context) error { return applySecurity(ctx, *p.security) })
+	}
+	if p.signature != nil {
+		steps = append(steps, func(ctx *model.Context) error { return applySignature(ctx, *p.signature, p.signer) })
+	}
+
+	return steps
+}
+
+// Apply the modifications to a PDF document, signing it last if requested.
+func (p postProcessing) apply(ctx context.Context, doc []byte) (_ []byte, err error) {
+	doc, err = processPDF(doc, p.steps()...)
+	if err != nil || p.signature == nil {
+		return doc, err
+	}
+
+	ctx, end := startPhase(ctx, "sign")
+	defer end(&err)
+
+	return signPDF(ctx, doc, p.signer)
+}
+
+// Apply modifications to a PDF document, in order.
+func processPDF(doc []byte, steps ...pdfStep) ([]byte, error) {
+	ctx, err := api.ReadContext(bytes.NewReader(doc), newPDFConfiguration())
+	if err != nil {
+		return nil, fmt.Errorf("error reading PDF: %w", err)
+	}
+	// Objects in object streams are decoded lazily, and references from objects not yet decoded may be lost when writing
+	// a modified document. Decode them all upfront.
+	for nr, entry := range ctx.Table {
+		if entry == nil {
+			continue
+		}
+		if _, ok := entry.Object.(types.LazyObjectStreamObject); ok {
+			if _, err := ctx.Dereference(*types.NewIndirectRef(nr, *entry.Generation)); err != nil {
+				return nil, fmt.Errorf("error reading PDF: %w", err)
+			}
+		}
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		return nil, fmt.Errorf("error reading PDF pages: %w", err)
+	}
+
+	for _, step := range steps {
+		if err := step(ctx); err != nil {
+			return nil, err
+		}
+	}
+	dates, err := infoDates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := api.WriteContext(ctx, &out); err != nil {
+		return nil, fmt.Errorf("error writing PDF: %w", err)
+	}
+
+	return restoreInfoDates(out.Bytes(), dates)
+}
+
+// Get the dates of the document information dictionary, by key.
+func infoDates(ctx *model.Context) (map[string]string, error) {
+	dates := map[string]string{}
+	if ctx.Info == nil {
+		return dates, nil
+	}
+
+	info, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil {
+		return nil, fmt.Errorf("error reading document information: %w", err)
+	}
+	for _, key := range []string{"CreationDate", "ModDate"} {
+		if date, ok := info[key].(types.StringLiteral); ok {
+			dates[key] = date.Value()
+		}
+	}
+
+	return dates, nil
+}
+
+// Restore the dates of the document information dictionary in a written PDF, as pdfcpu sets them to the current time
+// when writing a whole document. They are set in an incremental update, which pdfcpu writes as is. Dates are not
+// restored in encrypted documents, as strings of the update would have to be encrypted too.
+func restoreInfoDates(doc []byte, dates map[string]string) ([]byte, error) {
+	if len(dates) == 0 {
+		return doc, nil
+	}
+
+	ctx, err := api.ReadContext(bytes.NewReader(doc), newPDFConfiguration())
+	if err != nil {
+		return nil, fmt.Errorf("error reading PDF: %w", err)
+	}
+	if ctx.Info == nil || ctx.Encrypt != nil {
+		return doc, nil
+	}
+	info, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil {
+		return nil, fmt.Errorf("error reading document information: %w", err)
+	}
+	changed := false
+	for key, date := range dates {
+		if current := info.StringEntry(key); current == nil || *current != date {
+			info.Update(key, types.StringLiteral(date))
+			changed = true
+		}
+	}
+	if !changed {
+		return doc, nil
+	}
+
+	ctx.Write.Increment = true
+	ctx.Write.Offset = ctx.Read.FileSize
+	ctx.Write.IncrementWithObjNr(ctx.Info.ObjectNumber.Value())
+	out := bytes.NewBuffer(doc)
+	if err := api.WriteIncrement(ctx, out); err != nil {
+		return nil, fmt.Errorf("error writing document information: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// Matches the type of page dictionaries, of page tree nodes ("/Pages") to tell them apart, and of object streams.
+var pageTypeRegexp = regexp.MustCompile(`/Type\s*/(Pages?|ObjStm)`)
+
+// Maximum length of the end of the data kept between reads, to find page types split across them.
+const maxPageTypeLength = 32
+
+// Reader of a PDF printed by Chromium, counting pages while the document is read. Chromium does not compress the
+// dictionaries of pages, so their type can be found in the data, unless they are stored in object streams.
+type pageCounter struct {
+	r             *StreamHandleReader
+	pages         int
+	objectStreams bool   // Whether object streams were found, whose objects may be pages that cannot be counted.
+	tail          []byte // End of the data read so far, which may contain the start of a page type.
+}
+
+// Implement io.Reader interface.
+func (pc *pageCounter) Read(p []byte) (int, error) {
+	n, err := pc.r.Read(p)
+	pc.scan(p[:n])
+
+	return n, err
+}
+
+// Count the page types in the data, keeping its end for the next read.
+func (pc *pageCounter) scan(p []byte) {
+	window := append(pc.tail, p...)
+	keep := max(len(window)-maxPageTypeLength, 0)
+	for _, m := range pageTypeRegexp.FindAllSubmatchIndex(window, -1) {
+		typ := string(window[m[2]:m[3]])
+		if typ == "Page" && m[1] == len(window) {
+			// Could still be a page tree node, depending on the next byte.
+			keep = m[0]
+
+			break
+		}
+		switch typ {
+		case "Page":
+			pc.pages++
+		case "ObjStm":
+			pc.objectStreams = true
+		}
+		keep = max(keep, m[1])
+	}
+	pc.tail = slices.Clone(window[keep:])
+}
+
+// Get the number of pages read, and whether it is reliable. It is not if the document has object streams.
+func (pc *pageCounter) count() (int, bool) {
+	return pc.pages, !pc.objectStreams
+}
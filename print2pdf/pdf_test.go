@@ -0,0 +1,233 @@
+package print2pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Build a PDF document with the given number of pages, each one with a square, as Chromium would, with an information dictionary.
+func testPDF(pages int) []byte {
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Producer (Skia/PDF) /CreationDate (D:20200101000000+00'00') /ModDate (D:20200101000000+00'00') >>",
+	}
+	var kids []string
+	for range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", len(objs)+1))
+		objs = append(objs,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 200] /Contents %d 0 R >>", len(objs)+2),
+			"<< /Length 25 >>\nstream\n0 0 1 rg 10 10 50 50 re f\nendstream",
+		)
+	}
+	objs[1] = fmt.Sprintf("<< /Type /Pages /Kids %s /Count %d >>", kids, pages)
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+
+	return b.Bytes()
+}
+
+// Rewrite a PDF document with objects in object streams, as a cross-reference stream.
+func compressTestPDF(t *testing.T, doc []byte) []byte {
+	t.Helper()
+
+	conf := newPDFConfiguration()
+	conf.WriteObjectStream = true
+	conf.WriteXRefStream = true
+	var out bytes.Buffer
+	if err := api.Optimize(bytes.NewReader(doc), &out, conf); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.Bytes()
+}
+
+// Read and validate a PDF document.
+func readTestPDF(t *testing.T, doc []byte) *model.Context {
+	t.Helper()
+
+	ctx, err := api.ReadContext(bytes.NewReader(doc), newPDFConfiguration())
+	if err != nil {
+		t.Fatalf("error reading PDF: %s", err)
+	}
+	if err := api.ValidateContext(ctx); err != nil {
+		t.Fatalf("invalid PDF: %s", err)
+	}
+
+	return ctx
+}
+
+func TestProcessPDFKeepsInfoDates(t *testing.T) {
+	// Metadata dates differ from the current time, which pdfcpu sets when writing.
+	metadataDate := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	timeNow = func() time.Time { return metadataDate }
+	t.Cleanup(func() { timeNow = time.Now })
+	archival := ArchivalMap["pdfa-2b"]
+	steps := postProcessing{metadata: &PDFMetadata{Title: "Test"}, archival: &archival}.steps()
+
+	out, err := processPDF(testPDF(1), steps...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := readTestPDF(t, out)
+
+	info, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmp := regexp.MustCompile(`<xmp:(CreateDate|ModifyDate|MetadataDate)>([^<]*)<`).FindAllSubmatch(out, -1)
+	if len(xmp) != 3 {
+		t.Fatalf("expected 3 XMP dates, got %d", len(xmp))
+	}
+	for _, m := range xmp {
+		date, err := time.Parse(time.RFC3339, string(m[2]))
+		if err != nil {
+			t.Fatalf("invalid XMP %s: %s", m[1], err)
+		}
+		if !date.Equal(metadataDate) {
+			t.Errorf("XMP %s is %s, want the metadata date", m[1], m[2])
+		}
+		for _, key := range []string{"CreationDate", "ModDate"} {
+			if d := info.StringEntry(key); d == nil || *d != types.DateString(date) {
+				t.Errorf("XMP %s is %s, but %s is %s", m[1], m[2], key, info[key])
+			}
+		}
+	}
+}
+
+func TestProcessPDFKeepsOriginalInfoDates(t *testing.T) {
+	// Dates of the input document differ from the current time, which pdfcpu sets when writing.
+	out, err := processPDF(testPDF(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := readTestPDF(t, out)
+
+	info, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"CreationDate", "ModDate"} {
+		if date := info.StringEntry(key); date == nil || *date != "D:20200101000000+00'00'" {
+			t.Errorf("%s is %s, want the original date", key, info[key])
+		}
+	}
+}
+
+func TestRestoreInfoDates(t *testing.T) {
+	dates := map[string]string{"CreationDate": "D:20200101000000+00'00'", "ModDate": "D:20210101000000+00'00'"}
+
+	tests := []struct {
+		name string
+		doc  []byte
+	}{
+		{"cross-reference table", testPDF(1)},
+		{"object streams", compressTestPDF(t, testPDF(1))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := restoreInfoDates(bytes.Clone(tt.doc), dates)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(out, tt.doc) {
+				t.Error("expected the dates to be set in an incremental update")
+			}
+			ctx := readTestPDF(t, out)
+
+			info, err := ctx.DereferenceDict(*ctx.Info)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, expected := range dates {
+				if date := info.StringEntry(key); date == nil || *date != expected {
+					t.Errorf("%s is %s, want %s", key, info[key], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestPageCounter(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     []byte
+		pages   int
+		counted bool
+	}{
+		{"one page", testPDF(1), 1, true},
+		{"several pages", testPDF(3), 3, true},
+		{"object streams", compressTestPDF(t, testPDF(3)), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Split the document at every offset, to find page types split across reads.
+			for i := range len(tt.doc) + 1 {
+				pc := &pageCounter{}
+				pc.scan(tt.doc[:i])
+				pc.scan(tt.doc[i:])
+				pages, counted := pc.count()
+				if counted != tt.counted || (counted && pages != tt.pages) {
+					t.Fatalf("split at %d: expected %d pages (counted: %t), got %d (counted: %t)", i, tt.pages, tt.counted, pages, counted)
+				}
+			}
+		})
+	}
+}
+
+func TestPageCounterKeepsSplitTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		reads []string
+		pages int
+	}{
+		{"page in one read", []string{"<< /Type /Page >>"}, 1},
+		{"page split in its name", []string{"<< /Type /Pa", "ge >>"}, 1},
+		{"page split after its name", []string{"<< /Type /Page", " >>"}, 1},
+		{"page split before its name", []string{"<< /Type", " /Page >>"}, 1},
+		{"page tree node split after page", []string{"<< /Type /Page", "s >>"}, 0},
+		{"page split at the end", []string{"<< /Type /Page"}, 0},
+		{"pages in several reads", []string{"<< /Type /Page >> << /Ty", "pe /Page >> << /Type /Pages", " >>", "<< /Type /Page >>"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pc := &pageCounter{}
+			for _, r := range tt.reads {
+				pc.scan([]byte(r))
+			}
+			if pages, _ := pc.count(); pages != tt.pages {
+				t.Errorf("expected %d pages, got %d", tt.pages, pages)
+			}
+		})
+	}
+}
+
+func TestPostProcessingCountsPages(t *testing.T) {
+	var pages int
+	p := postProcessing{metadata: &PDFMetadata{Title: "Test"}, pages: &pages}
+	if _, err := processPDF(compressTestPDF(t, testPDF(3)), p.steps()...); err != nil {
+		t.Fatal(err)
+	}
+	if pages != 3 {
+		t.Errorf("expected 3 pages, got %d", pages)
+	}
+}
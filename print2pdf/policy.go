@@ -0,0 +1,140 @@
+package print2pdf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"sync"
+)
+
+// Deny requests made by documents to loopback, private, link-local and cloud metadata addresses, to protect against
+// server-side request forgery. The host of every request is resolved before it is sent, and the address the response
+// came from is checked again to detect DNS rebinding, failing the print if it is the page itself. As the browser
+// resolves hosts on its own, a request to a denied address can still be sent in between: use a firewall for a strict
+// enforcement. WebSockets are blocked altogether, as their handshakes cannot be checked. Default is false.
+var DenyPrivateNetworks = false
+
+// Networks allowed even when DenyPrivateNetworks is set. Default is empty.
+var AllowedNetworks []netip.Prefix
+
+// Check the URL of every document loaded in the page and in its frames, including every redirect, returning an error if
+// it is not allowed. Frames which are not allowed are blocked, while the print fails if the page is not allowed. Default
+// is nil, meaning all URLs are allowed.
+var AllowDocumentUrl func(u string) error
+
+// URL patterns of WebSockets, blocked by DenyPrivateNetworks as the Fetch domain does not intercept their handshakes.
+var webSocketUrls = []string{"ws://*", "wss://*"}
+
+// Networks denied by DenyPrivateNetworks, in addition to loopback, private, link-local, multicast and unspecified ones.
+var deniedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This" network.
+	netip.MustParsePrefix("100.64.0.0/10"), // Shared address space, used by some cloud metadata services.
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments.
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking.
+	netip.MustParsePrefix("240.0.0.0/4"),   // Reserved, including broadcast.
+}
+
+// Well-known prefix of IPv6 addresses embedding IPv4 addresses for NAT64.
+var nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// Error returned when a request made by a document is denied by DenyPrivateNetworks or AllowDocumentUrl.
+type DeniedRequestError struct {
+	// URL of the denied request.
+	Url string
+	// Reason of the denial.
+	Reason string
+}
+
+// Implement error interface.
+func (e DeniedRequestError) Error() string {
+	return fmt.Sprintf("request to %s denied: %s", e.Url, e.Reason)
+}
+
+// Check if an IP address is denied by DenyPrivateNetworks, unless it belongs to the allowed networks.
+func isDeniedAddr(addr netip.Addr, allowed []netip.Prefix) bool {
+	addr = addr.Unmap()
+	if nat64Prefix.Contains(addr) {
+		b := addr.As16()
+		addr = netip.AddrFrom4([4]byte(b[12:]))
+	}
+	if slices.ContainsFunc(allowed, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+		return false
+	}
+
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() ||
+		slices.ContainsFunc(deniedNetworks, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+// Checker of the addresses requested by a document, caching resolved hosts.
+type networkPolicy struct {
+	allowed []netip.Prefix // Networks allowed even if private or local.
+	hosts   sync.Map       // Reason for denying each checked host, empty if allowed.
+}
+
+// Check that a URL does not point to a denied address, resolving its host if needed.
+func (p *networkPolicy) checkUrl(ctx context.Context, rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return DeniedRequestError{rawUrl, "invalid URL"}
+	}
+
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+	case "file":
+		return DeniedRequestError{rawUrl, "local files cannot be loaded"}
+	default:
+		// Other schemes, such as data and blob, do not reach the network.
+		return nil
+	}
+
+	host := u.Hostname()
+	reason, ok := p.hosts.Load(host)
+	if !ok {
+		reason = ""
+		if err := p.checkHost(ctx, host); err != nil {
+			reason = err.Error()
+		}
+		p.hosts.Store(host, reason)
+	}
+	if reason != "" {
+		return DeniedRequestError{rawUrl, reason.(string)}
+	}
+
+	return nil
+}
+
+// Check that a host does not resolve to any denied address.
+func (p *networkPolicy) checkHost(ctx context.Context, host string) error {
+	addrs := []netip.Addr{}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = append(addrs, addr)
+	} else {
+		resolved, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return fmt.Errorf("host %s cannot be resolved", host)
+		}
+		addrs = append(addrs, resolved...)
+	}
+
+	for _, addr := range addrs {
+		if isDeniedAddr(addr, p.allowed) {
+			return fmt.Errorf("address %s of host %s is not allowed", addr.Unmap(), host)
+		}
+	}
+
+	return nil
+}
+
+// Check that the remote address a response came from is not denied.
+func (p *networkPolicy) checkRemoteAddr(rawUrl, remote string) error {
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !isDeniedAddr(addr, p.allowed) {
+		return nil
+	}
+
+	return DeniedRequestError{rawUrl, fmt.Sprintf("response came from address %s, which is not allowed", addr.Unmap())}
+}
@@ -0,0 +1,103 @@
+package print2pdf
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+)
+
+func TestIsDeniedAddr(t *testing.T) {
+	allowed := []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}
+
+	tests := []struct {
+		addr   string
+		denied bool
+	}{
+		{"93.184.215.14", false},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", false},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.0.0.1", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"172.32.0.1", false},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"fd00:ec2::254", true},
+		{"::ffff:169.254.169.254", true},
+		{"::ffff:127.0.0.1", true},
+		{"64:ff9b::a9fe:a9fe", true},
+		{"64:ff9b::5db8:d70e", false},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"224.0.0.1", true},
+		{"ff02::1", true},
+		{"100.100.100.200", true},
+		{"255.255.255.255", true},
+		{"10.1.2.3", false},
+		{"::ffff:10.1.2.3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if denied := isDeniedAddr(netip.MustParseAddr(tt.addr), allowed); denied != tt.denied {
+				t.Errorf("expected denied to be %t, got %t", tt.denied, denied)
+			}
+		})
+	}
+}
+
+func TestNetworkPolicyCheckUrl(t *testing.T) {
+	p := &networkPolicy{allowed: []netip.Prefix{netip.MustParsePrefix("192.168.10.0/24")}}
+
+	tests := []struct {
+		name   string
+		url    string
+		denied bool
+	}{
+		{"public address", "https://93.184.215.14/page", false},
+		{"public IPv6 address", "http://[2606:2800:21f:cb07:6820:80da:af6b:8b2c]:8080/", false},
+		{"loopback", "http://127.0.0.1:8080/", true},
+		{"IPv6 loopback", "http://[::1]/", true},
+		{"metadata", "http://169.254.169.254/latest/meta-data/", true},
+		{"WebSocket", "ws://10.0.0.1/socket", true},
+		{"allowed network", "https://192.168.10.5/", false},
+		{"file", "file:///etc/passwd", true},
+		{"data", "data:text/plain,hello", false},
+		{"unsupported scheme", "chrome://settings", false},
+		{"unresolvable host", "https://print2pdf.invalid/", true},
+		{"invalid URL", "http://[::1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.checkUrl(context.Background(), tt.url)
+			if _, ok := err.(DeniedRequestError); ok != tt.denied {
+				t.Errorf("expected denied to be %t, got %v", tt.denied, err)
+			}
+		})
+	}
+}
+
+func TestNetworkPolicyCheckRemoteAddr(t *testing.T) {
+	p := &networkPolicy{allowed: []netip.Prefix{netip.MustParsePrefix("fd00:1::/64")}}
+
+	tests := []struct {
+		remote string
+		denied bool
+	}{
+		{"93.184.215.14", false},
+		{"10.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"fd00:1::1", false},
+		{"fd00:2::1", true},
+		{"", false},
+		{"not an address", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.remote, func(t *testing.T) {
+			err := p.checkRemoteAddr("https://example.com/", tt.remote)
+			if _, ok := err.(DeniedRequestError); ok != tt.denied {
+				t.Errorf("expected denied to be %t, got %v", tt.denied, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package print2pdf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Number of browser processes started by StartBrowser(). Default is 1. See WithPoolSize().
+var PoolSize = 1
+
+// Maximum number of concurrent tabs for each browser process started by StartBrowser(). Zero means no limit. Default is 10.
+var MaxTabs = 10
+
+// Maximum time a print waits for a free tab when all browsers started by StartBrowser() are busy. Zero means no limit.
+// Default is 30 seconds.
+var QueueTimeout = 30 * time.Second
+
+// Delay before the first restart attempt of a browser started by StartBrowser() that exited shortly after starting.
+// Doubled after every failed attempt.
+var RestartBackoff = time.Second
+
+// Maximum delay between restart attempts of a browser started by StartBrowser().
+var MaxRestartBackoff = time.Minute
+
+// Error returned when no tab becomes available before QueueTimeout expires.
+var ErrQueueTimeout = errors.New("timed out waiting for a free browser tab")
+
+// A single browser process managed by the pool.
+type browser struct {
+	ctx     context.Context    // Browser context, cancelled when the process exits.
+	cancel  context.CancelFunc // Close the browser.
+	started time.Time          // Time the browser was started at.
+	tabs    int                // Number of tabs currently in use.
+}
+
+// Check if the browser process is still running.
+func (b *browser) running() bool {
+	return b.ctx.Err() == nil
+}
+
+// Pool of browser processes, each serving a bounded number of concurrent tabs.
+type browserPool struct {
+	ctx               context.Context // Pool context, cancelled when the pool must be closed.
+	mu                sync.Mutex
+	browsers          []*browser
+	opts              []chromedp.ExecAllocatorOption // Options of the browser processes.
+	maxTabs           int
+	timeout           time.Duration
+	restartBackoff    time.Duration
+	maxRestartBackoff time.Duration
+	waiting           int           // Number of prints waiting for a free tab.
+	released          chan struct{} // Closed, and replaced, every time a tab is released.
+
+	// Start a browser process, and run a function in a new tab of a browser. Replaced in tests.
+	start  func(ctx context.Context, opts []chromedp.ExecAllocatorOption) (*browser, error)
+	runTab func(ctx context.Context, b *browser, fn func(ctx context.Context) error) error
+}
+
+// Start a new browser process. Cancelling the context will close the browser.
+func startBrowserProcess(ctx context.Context, opts []chromedp.ExecAllocatorOption) (*browser, error) {
+	start := time.Now()
+	allocatorCtx, allocatorCancel := chromedp.NewExecAllocator(ctx, opts...)
+	browserCtx, browserCancel := chromedp.NewContext(allocatorCtx)
+	cancel := func() {
+		browserCancel()
+		allocatorCancel()
+	}
+
+	// Navigate to blank page so that the browser is started.
+	err := chromedp.Run(browserCtx, chromedp.Tasks{chromedp.Navigate("about:blank")})
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	logger(ctx).InfoContext(ctx, "browser started", durationMs(time.Since(start)))
+
+	return &browser{ctx: browserCtx, cancel: cancel, started: time.Now()}, nil
+}
+
+// Start a pool of browsers configured by a printer, each one restarted by a supervisor when it exits.
+// Cancelling the context will close all browsers.
+func newBrowserPool(ctx context.Context, pr *Printer) (*browserPool, error) {
+	if pr.poolSize < 1 {
+		return nil, fmt.Errorf("invalid browser pool size %d, must be at least 1", pr.poolSize)
+	}
+
+	opts := slices.Clone(chromedp.DefaultExecAllocatorOptions[:])
+	if pr.chromiumPath != "" {
+		opts = append(opts, chromedp.ExecPath(pr.chromiumPath))
+	}
+	p := &browserPool{
+		ctx:               ctx,
+		browsers:          make([]*browser, 0, pr.poolSize),
+		opts:              append(opts, pr.flags...),
+		maxTabs:           pr.maxTabs,
+		timeout:           pr.queueTimeout,
+		restartBackoff:    pr.restartBackoff,
+		maxRestartBackoff: pr.maxRestartBackoff,
+		start:             startBrowserProcess,
+		runTab:            runInNewTab,
+		released:          make(chan struct{}),
+	}
+	for range pr.poolSize {
+		b, err := p.start(ctx, p.opts)
+		if err != nil {
+			p.close()
+
+			return nil, err
+		}
+
+		p.browsers = append(p.browsers, b)
+	}
+	for i := range p.browsers {
+		go p.supervise(i)
+	}
+
+	return p, nil
+}
+
+// Watch the browser in the given slot of the pool, and restart it with exponential backoff whenever it exits.
+// Returns when the pool context is cancelled.
+func (p *browserPool) supervise(slot int) {
+	backoff := p.restartBackoff
+	for {
+		p.mu.Lock()
+		b := p.browsers[slot]
+		p.mu.Unlock()
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-b.ctx.Done():
+		}
+		if p.ctx.Err() != nil {
+			return
+		}
+		b.cancel()
+
+		// Wait before restarting only if the browser crashed soon after starting, to avoid a restart loop.
+		var delay time.Duration
+		if time.Since(b.started) < p.maxRestartBackoff {
+			delay = backoff
+			backoff = min(backoff*2, p.maxRestartBackoff)
+		} else {
+			backoff = p.restartBackoff
+		}
+		logger(p.ctx).WarnContext(p.ctx, "browser exited, restarting", "browser", slot, "delay", delay.String())
+
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			nb, err := p.start(p.ctx, p.opts)
+			if err == nil {
+				p.mu.Lock()
+				p.browsers[slot] = nb
+				p.wake()
+				p.mu.Unlock()
+				browserRestarts.Add(p.ctx, 1)
+
+				break
+			}
+
+			delay = backoff
+			backoff = min(backoff*2, p.maxRestartBackoff)
+			logger(p.ctx).ErrorContext(p.ctx, "error restarting browser", "browser", slot, "delay", delay.String(), "error", err)
+		}
+	}
+}
+
+// Close all browsers in the pool.
+func (p *browserPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, b := range p.browsers {
+		b.cancel()
+	}
+}
+
+// Check if at least one browser in the pool is running.
+func (p *browserPool) running() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.anyRunning()
+}
+
+// Find the running browser with the fewest tabs in use and a free slot. Must be called with the lock held.
+func (p *browserPool) leastLoaded() *browser {
+	var found *browser
+	for _, b := range p.browsers {
+		if !b.running() || (p.maxTabs > 0 && b.tabs >= p.maxTabs) {
+			continue
+		}
+		if found == nil || b.tabs < found.tabs {
+			found = b
+		}
+	}
+
+	return found
+}
+
+// Reserve a tab on the least loaded browser, waiting for one to be released or restarted if all browsers are busy.
+// The returned browser must be handed back with release() once the tab is closed.
+func (p *browserPool) acquire(ctx context.Context) (_ *browser, err error) {
+	ctx, end := startPhase(ctx, "queue")
+	defer end(&err)
+
+	var timeout <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if b := p.leastLoaded(); b != nil {
+			b.tabs++
+
+			return b, nil
+		}
+		if p.ctx.Err() != nil {
+			return nil, fmt.Errorf("browser pool closed: %w", p.ctx.Err())
+		}
+
+		released := p.released
+		p.waiting++
+		p.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-timeout:
+			err = ErrQueueTimeout
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+
+		p.mu.Lock()
+		p.waiting--
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Check if at least one browser is running. Must be called with the lock held.
+func (p *browserPool) anyRunning() bool {
+	for _, b := range p.browsers {
+		if b.running() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Release a tab reserved with acquire(), waking up any waiting print.
+func (p *browserPool) release(b *browser) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b.tabs--
+	p.wake()
+}
+
+// Wake up all prints waiting for a free tab. Must be called with the lock held.
+func (p *browserPool) wake() {
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+// Collect statistics about the pool: running browsers, tabs in use and waiting prints.
+func (p *browserPool) stats() (browsers, tabs, waiting int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, b := range p.browsers {
+		if b.running() {
+			browsers++
+			tabs += b.tabs
+		}
+	}
+
+	return browsers, tabs, p.waiting
+}
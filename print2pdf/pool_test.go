@@ -0,0 +1,405 @@
+package print2pdf
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Create a pool of fake browsers, with the given number of tabs in use, without starting any process.
+func newTestPool(t *testing.T, maxTabs int, tabs ...int) *browserPool {
+	t.Helper()
+
+	p := &browserPool{ctx: t.Context(), maxTabs: maxTabs, released: make(chan struct{})}
+	for _, n := range tabs {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		p.browsers = append(p.browsers, &browser{ctx: ctx, cancel: cancel, started: time.Now(), tabs: n})
+	}
+
+	return p
+}
+
+// Wait until the given number of prints are waiting for a free tab.
+func waitForWaiting(t *testing.T, p *browserPool, expected int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, _, waiting := p.stats(); waiting == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d waiting prints", expected)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBrowserPoolAcquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxTabs  int
+		tabs     []int
+		stopped  []int
+		expected int
+	}{
+		{"single browser", 2, []int{0}, nil, 0},
+		{"least loaded", 10, []int{3, 1, 2}, nil, 1},
+		{"first of equally loaded", 10, []int{2, 1, 1}, nil, 1},
+		{"stopped browser is skipped", 10, []int{3, 0, 2}, []int{1}, 2},
+		{"full browser is skipped", 2, []int{2, 1}, nil, 1},
+		{"no limit", 0, []int{100, 200}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPool(t, tt.maxTabs, tt.tabs...)
+			for _, i := range tt.stopped {
+				p.browsers[i].cancel()
+			}
+
+			b, err := p.acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b != p.browsers[tt.expected] {
+				t.Errorf("expected browser %d to be acquired, got %+v", tt.expected, b)
+			}
+			if b.tabs != tt.tabs[tt.expected]+1 {
+				t.Errorf("expected %d tabs in use, got %d", tt.tabs[tt.expected]+1, b.tabs)
+			}
+		})
+	}
+}
+
+func TestBrowserPoolAcquireTimeout(t *testing.T) {
+	p := newTestPool(t, 2, 2, 2)
+	p.timeout = 20 * time.Millisecond
+
+	start := time.Now()
+	if _, err := p.acquire(context.Background()); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("expected queue timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < p.timeout {
+		t.Errorf("expected to wait at least %s, waited %s", p.timeout, elapsed)
+	}
+	if browsers, tabs, waiting := p.stats(); browsers != 2 || tabs != 4 || waiting != 0 {
+		t.Errorf("expected 2 browsers, 4 tabs and no waiting prints, got %d, %d and %d", browsers, tabs, waiting)
+	}
+}
+
+func TestBrowserPoolAcquireCancelled(t *testing.T) {
+	p := newTestPool(t, 1, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := p.acquire(ctx)
+		done <- err
+	}()
+	waitForWaiting(t, p, 1)
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context to be cancelled, got %v", err)
+	}
+}
+
+func TestBrowserPoolReleaseWakesWaiter(t *testing.T) {
+	p := newTestPool(t, 1, 1, 1)
+
+	type result struct {
+		b   *browser
+		err error
+	}
+	done := make(chan result)
+	for range 2 {
+		go func() {
+			b, err := p.acquire(context.Background())
+			done <- result{b, err}
+		}()
+	}
+	waitForWaiting(t, p, 2)
+	if browsers, tabs, _ := p.stats(); browsers != 2 || tabs != 2 {
+		t.Errorf("expected 2 browsers and 2 tabs, got %d and %d", browsers, tabs)
+	}
+
+	p.release(p.browsers[1])
+	r := <-done
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.b != p.browsers[1] {
+		t.Errorf("expected the released browser to be acquired, got %+v", r.b)
+	}
+	waitForWaiting(t, p, 1)
+
+	p.release(p.browsers[0])
+	if r := <-done; r.err != nil || r.b != p.browsers[0] {
+		t.Errorf("expected the released browser to be acquired, got %+v and %v", r.b, r.err)
+	}
+	if browsers, tabs, waiting := p.stats(); browsers != 2 || tabs != 2 || waiting != 0 {
+		t.Errorf("expected 2 browsers, 2 tabs and no waiting prints, got %d, %d and %d", browsers, tabs, waiting)
+	}
+}
+
+func TestBrowserPoolStats(t *testing.T) {
+	p := newTestPool(t, 10, 2, 3, 1)
+	p.browsers[1].cancel()
+
+	if browsers, tabs, waiting := p.stats(); browsers != 2 || tabs != 3 || waiting != 0 {
+		t.Errorf("expected 2 browsers, 3 tabs and no waiting prints, got %d, %d and %d", browsers, tabs, waiting)
+	}
+	if !p.running() {
+		t.Error("expected pool to be running")
+	}
+
+	p.close()
+	if browsers, tabs, _ := p.stats(); browsers != 0 || tabs != 0 {
+		t.Errorf("expected no browsers and no tabs after closing, got %d and %d", browsers, tabs)
+	}
+	if p.running() {
+		t.Error("expected pool not to be running after closing")
+	}
+}
+
+// Fake starter of browser processes, failing the given number of times before starting a browser.
+type fakeStarter struct {
+	mu       sync.Mutex
+	failures int
+	calls    []time.Time
+}
+
+func (s *fakeStarter) start(ctx context.Context, _ []chromedp.ExecAllocatorOption) (*browser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, time.Now())
+	if len(s.calls) <= s.failures {
+		return nil, errors.New("browser failed to start")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &browser{ctx: ctx, cancel: cancel, started: time.Now()}, nil
+}
+
+func (s *fakeStarter) startedAt() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.calls)
+}
+
+type tabBrowserKey struct{}
+
+// Run a function in a fake tab, closed when the browser exits. The browser of the tab can be crashed with crashTab().
+func runInFakeTab(ctx context.Context, b *browser, fn func(ctx context.Context) error) error {
+	tabCtx, tabCancel := context.WithCancel(context.WithValue(ctx, tabBrowserKey{}, b))
+	defer tabCancel()
+	stop := context.AfterFunc(b.ctx, tabCancel)
+	defer stop()
+
+	return fn(tabCtx)
+}
+
+// Make the browser of a fake tab exit, as if its process crashed, and wait for the tab to be closed.
+func crashTab(ctx context.Context) error {
+	ctx.Value(tabBrowserKey{}).(*browser).cancel()
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+// Create a pool of a single fake browser, restarted by a supervisor.
+func newSupervisedTestPool(t *testing.T, s *fakeStarter) *browserPool {
+	t.Helper()
+
+	p := newTestPool(t, 10, 0)
+	p.restartBackoff = 10 * time.Millisecond
+	p.maxRestartBackoff = time.Minute
+	p.start = s.start
+	p.runTab = runInFakeTab
+	go p.supervise(0)
+
+	return p
+}
+
+// Wait until the browser in the first slot of the pool is replaced by a running one.
+func waitForRestart(t *testing.T, p *browserPool, old *browser) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p.mu.Lock()
+		b := p.browsers[0]
+		p.mu.Unlock()
+		if b != old && b.running() {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the browser to restart")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBrowserPoolRetriesCrashedPrint(t *testing.T) {
+	s := &fakeStarter{}
+	p := newSupervisedTestPool(t, s)
+	pr := &Printer{pool: p}
+	crashed := p.browsers[0]
+
+	var attempts int
+	var handled bool
+	err := p.runInTab(context.Background(), func(ctx context.Context) error {
+		attempts++
+		if attempts == 1 {
+			return crashTab(ctx)
+		}
+		if b := ctx.Value(tabBrowserKey{}).(*browser); b == crashed {
+			t.Error("expected the print to be retried on the restarted browser")
+		}
+
+		return nil
+	}, &handled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected the print to be attempted 2 times, got %d", attempts)
+	}
+	if starts := len(s.startedAt()); starts != 1 {
+		t.Errorf("expected the browser to be restarted once, got %d", starts)
+	}
+	if !pr.Running() {
+		t.Error("expected the printer to be running after the restart")
+	}
+	if browsers, tabs, waiting := p.stats(); browsers != 1 || tabs != 0 || waiting != 0 {
+		t.Errorf("expected 1 browser, no tabs and no waiting prints, got %d, %d and %d", browsers, tabs, waiting)
+	}
+}
+
+func TestBrowserPoolRunInTab(t *testing.T) {
+	errPrint := errors.New("print failed")
+
+	tests := []struct {
+		name     string
+		fn       func(ctx context.Context, handled *bool) error
+		attempts int
+		crashed  bool
+		err      error
+	}{
+		{"success", func(ctx context.Context, handled *bool) error { return nil }, 1, false, nil},
+		{"error", func(ctx context.Context, handled *bool) error { return errPrint }, 1, false, errPrint},
+		{"crash", func(ctx context.Context, handled *bool) error { return crashTab(ctx) }, 2, true, errBrowserCrashed},
+		{"crash after handling", func(ctx context.Context, handled *bool) error {
+			*handled = true
+
+			return crashTab(ctx)
+		}, 1, true, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newSupervisedTestPool(t, &fakeStarter{})
+			crashed := p.browsers[0]
+
+			var attempts int
+			var handled bool
+			err := p.runInTab(context.Background(), func(ctx context.Context) error {
+				attempts++
+
+				return tt.fn(ctx, &handled)
+			}, &handled)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+			if tt.err == context.Canceled && errors.Is(err, errBrowserCrashed) {
+				t.Errorf("expected a handled print not to be retried, got %v", err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("expected the print to be attempted %d times, got %d", tt.attempts, attempts)
+			}
+			if tt.crashed {
+				waitForRestart(t, p, crashed)
+			}
+		})
+	}
+}
+
+func TestBrowserPoolRunInTabCancelled(t *testing.T) {
+	p := newSupervisedTestPool(t, &fakeStarter{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var attempts int
+	var handled bool
+	err := p.runInTab(ctx, func(tabCtx context.Context) error {
+		attempts++
+		// The print is cancelled while the browser exits, so it must not be retried.
+		cancel()
+
+		return crashTab(tabCtx)
+	}, &handled)
+	if errors.Is(err, errBrowserCrashed) || attempts != 1 {
+		t.Errorf("expected a cancelled print not to be retried, got %d attempts and %v", attempts, err)
+	}
+}
+
+func TestBrowserPoolSupervise(t *testing.T) {
+	t.Run("backoff", func(t *testing.T) {
+		s := &fakeStarter{failures: 2}
+		p := newSupervisedTestPool(t, s)
+		crashed := p.browsers[0]
+		exited := time.Now()
+		crashed.cancel()
+		waitForRestart(t, p, crashed)
+
+		calls := s.startedAt()
+		if len(calls) != 3 {
+			t.Fatalf("expected 3 restart attempts, got %d", len(calls))
+		}
+		// The browser crashed right after starting, so every attempt waits twice as long as the previous one.
+		for i, prev := range append([]time.Time{exited}, calls[:2]...) {
+			if delay, expected := calls[i].Sub(prev), p.restartBackoff<<i; delay < expected {
+				t.Errorf("expected attempt %d to wait at least %s, waited %s", i+1, expected, delay)
+			}
+		}
+	})
+
+	t.Run("no backoff for long running browser", func(t *testing.T) {
+		p := newTestPool(t, 10, 0)
+		p.restartBackoff = time.Hour
+		p.maxRestartBackoff = time.Hour
+		p.start = (&fakeStarter{}).start
+		crashed := p.browsers[0]
+		crashed.started = time.Now().Add(-2 * time.Hour)
+		go p.supervise(0)
+		crashed.cancel()
+
+		waitForRestart(t, p, crashed)
+	})
+
+	t.Run("closed pool", func(t *testing.T) {
+		s := &fakeStarter{}
+		p := newTestPool(t, 10, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		p.ctx = ctx
+		p.start = s.start
+		done := make(chan struct{})
+		go func() {
+			p.supervise(0)
+			close(done)
+		}()
+
+		cancel()
+		p.close()
+		<-done
+		if calls := s.startedAt(); len(calls) != 0 {
+			t.Errorf("expected browsers of a closed pool not to be restarted, got %d attempts", len(calls))
+		}
+	})
+}
@@ -1,11 +1,13 @@
 /*
 Package print2pdf provides functions to save a webpage as a PDF file, leveraging Chromium and the DevTools Protocol.
 
-Requires the environment variable CHROMIUM_PATH to be set with the full path to the Chromium binary.
-
-The StartBrowser() function starts a headless instance of Chromium, to reduce startup time in long running services (like a web server),
+The StartBrowser() function starts a pool of headless instances of Chromium, to reduce startup time in long running services (like a web server),
 and therefore must be called before any call PrintPDF(). These functions can (and probably should) use different contexts: the one passed
 to StartBrowser() closes the whole browser when done or cancelled, while the one passed to PrintPDF() closes only the tab it uses.
+StartBrowser() requires the environment variable CHROMIUM_PATH to be set with the full path to the Chromium binary.
+
+To use several configurations in the same process, create a Printer with NewPrinter() and functional options such as
+WithChromiumPath() and WithPoolSize(), then call its Start(), Print() and Close() methods.
 */
 package print2pdf
 
@@ -19,44 +21,98 @@ import (
 	"os"
 	"slices"
 	"strings"
-	"time"
 
 	"github.com/chromedp/cdproto/cdp"
-	"github.com/chromedp/cdproto/emulation"
 	chromedpio "github.com/chromedp/cdproto/io"
-	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/cdproto/page"
-	"github.com/chromedp/chromedp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// Page margins of the generated PDF, in inches.
+// Page margins of the generated PDF. See Length for accepted units.
 type PrintMargins struct {
-	Top    float64 `json:"top,omitempty"`
-	Bottom float64 `json:"bottom,omitempty"`
-	Left   float64 `json:"left,omitempty"`
-	Right  float64 `json:"right,omitempty"`
+	Top    Length `json:"top,omitempty"`
+	Bottom Length `json:"bottom,omitempty"`
+	Left   Length `json:"left,omitempty"`
+	Right  Length `json:"right,omitempty"`
 }
 
 // Parameters for generating a PDF.
 type GetPDFParams struct {
-	// URL of the webpage to save. Required.
-	Url string `json:"url"`
-	// Filename of the generated PDF. A ".pdf" suffix will be appended if not present. Required.
+	// URL of the webpage to save. Required, unless Html is provided.
+	Url string `json:"url,omitempty"`
+	// HTML content to save, in place of a webpage. Required, unless Url is provided.
+	Html string `json:"html,omitempty"`
+	// Base URL used to resolve relative URLs of assets referenced by Html. Default is empty, meaning only absolute URLs are loaded.
+	BaseUrl string `json:"base_url,omitempty"`
+	// Filename of the generated file. The extension of the output format, as in OutputsMap, should be appended by callers if not present. Required.
 	FileName string `json:"file_name"`
+	// Output format. See OutputsMap for accepted values. Default is "pdf".
+	Output string `json:"output,omitempty"`
+	// Screenshot options, only used when Output is an image format. Default is capturing the viewport.
+	Screenshot *ScreenshotParams `json:"screenshot,omitempty"`
 	// Media type to emulate. Accepted values are "print" and "screen". Default is "print".
 	Media string `json:"media,omitempty"`
+	// Device and environment to emulate, such as viewport, locale and timezone. Default is nil, meaning the browser's ones.
+	Emulation *EmulationParams `json:"emulation,omitempty"`
 	// Page format. See FormatsMap for accepted values. Default is "A4".
 	Format string `json:"format,omitempty"`
+	// Page width, overriding Format. Must be provided together with Height. See Length for accepted units.
+	Width Length `json:"width,omitempty"`
+	// Page height, overriding Format. Must be provided together with Width. See Length for accepted units.
+	Height Length `json:"height,omitempty"`
+	// Give priority to the page size defined by the document's CSS "@page" rules over Format, Width and Height. Default is false.
+	PreferCSSPageSize bool `json:"prefer_css_page_size,omitempty"`
 	// Print background graphics. Default is true.
 	Background *bool `json:"background,omitempty"`
 	// Page orientation. Accepted values are "landscape" and "portrait". Default is "portrait".
 	Layout string `json:"layout,omitempty"`
-	// Page margins in inches. Default is all 0.
+	// Page margins. See Length for accepted units. Default is all 0.4 inches.
 	Margins *PrintMargins `json:"margin,omitempty"`
 	// Scale of the webpage rendering. Default is 1.
 	Scale float64 `json:"scale,omitempty"`
-	// Cookies forwarded from request to URL. Default is empty.
-	Cookies map[string]string `json:"-"`
+	// Header template, either HTML markup or the name of a built-in template. See TemplatesMap for built-in templates and
+	// supported classes. Margins must be large enough to fit it. Default is empty, meaning no header.
+	HeaderTemplate string `json:"header_template,omitempty"`
+	// Footer template, either HTML markup or the name of a built-in template. See TemplatesMap for built-in templates and
+	// supported classes. Margins must be large enough to fit it. Default is empty, meaning no footer.
+	FooterTemplate string `json:"footer_template,omitempty"`
+	// Conditions to wait for before printing. Default is waiting for "domcontentloaded" and "networkidle" events, without timeout.
+	Wait *WaitParams `json:"wait,omitempty"`
+	// Print the document even if it responds with an HTTP error status (4xx or 5xx), instead of failing with an
+	// HttpStatusError. Default is false.
+	AllowHttpErrors bool `json:"allow_http_errors,omitempty"`
+	// Fail with an ExceptionError if the document throws an uncaught JavaScript exception before printing. Default is false.
+	FailOnException bool `json:"fail_on_exception,omitempty"`
+	// Extra HTTP headers sent with the requests made by the document to its own origin, i.e. the one of Url or BaseUrl.
+	// Default is empty.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Credentials for HTTP basic authentication, only provided to the host of the document when it asks for them.
+	// Default is nil.
+	BasicAuth *BasicAuth `json:"basic_auth,omitempty"`
+	// Requests to block while loading the document, in addition to DefaultBlock. Default is nil.
+	Block *BlockParams `json:"block,omitempty"`
+	// CSS style sheets added to the document once loaded, after DefaultStyles. Default is empty.
+	Styles []string `json:"styles,omitempty"`
+	// JavaScript code run in the document once loaded, after DefaultScripts and styles, in order. A script returning a
+	// promise is awaited. Default is empty.
+	Scripts []string `json:"scripts,omitempty"`
+	// Text or image stamped over the pages of the PDF. Only supported by "pdf" output. Default is nil, meaning no watermark.
+	Watermark *WatermarkParams `json:"watermark,omitempty"`
+	// Metadata written in the PDF, replacing the one set by Chromium. Only supported by "pdf" output. Default is nil,
+	// meaning Chromium's metadata is kept.
+	Metadata *PDFMetadata `json:"metadata,omitempty"`
+	// Encryption and permissions of the PDF. Only supported by "pdf" output. Default is nil, meaning no encryption.
+	Security *SecurityParams `json:"security,omitempty"`
+	// PDF/A conformance level of the PDF, for long-term archival. See ArchivalMap for valid values. Only supported by
+	// "pdf" output, and not compatible with Security. Default is empty, meaning no conformance.
+	Archival string `json:"archival,omitempty"`
+	// Digital signature of the PDF, applied after every other modification. Requires Signer. Only supported by "pdf"
+	// output, and not compatible with Security. Default is nil, meaning the PDF is not signed.
+	Signature *SignatureParams `json:"signature,omitempty"`
+	// Certificate and key used for the signature, usually set from configuration. Default is nil.
+	Signer *Signer `json:"-"`
+	// Cookies set before loading the document, usually forwarded from the incoming request. Default is empty.
+	Cookies []*Cookie `json:"-"`
 }
 
 // Represents a print format's width and height, in inches.
@@ -80,6 +136,34 @@ var FormatsMap = map[string]PrintFormat{
 	"A6":      {4.13, 5.83},
 }
 
+// Represents an output format's file extension and content type.
+type OutputFormat struct {
+	Extension   string
+	ContentType string
+}
+
+// Map of output names to their file extension and content type. Image formats are captured as a screenshot.
+var OutputsMap = map[string]OutputFormat{
+	"pdf":  {".pdf", "application/pdf"},
+	"png":  {".png", "image/png"},
+	"jpeg": {".jpeg", "image/jpeg"},
+	"webp": {".webp", "image/webp"},
+}
+
+// Get the output format of the provided parameters, with default.
+func (data GetPDFParams) OutputFormat() (string, OutputFormat, error) {
+	if data.Output == "" {
+		return "pdf", OutputsMap["pdf"], nil
+	}
+
+	o, ok := OutputsMap[data.Output]
+	if !ok {
+		return "", OutputFormat{}, NewValidationError(fmt.Sprintf("invalid output \"%s\", valid outputs are: %s", data.Output, strings.Join(slices.Sorted(maps.Keys(OutputsMap)), ", ")))
+	}
+
+	return data.Output, o, nil
+}
+
 // Validation error in supplied parameter.
 type ValidationError struct {
 	message string
@@ -151,14 +235,15 @@ func (r *StreamHandleReader) Close() error {
 	return chromedpio.Close(r.h).Do(r.c)
 }
 
-// Chromium binary path. Required.
+// Chromium binary path, used by StartBrowser(). Required.
 var ChromiumPath = os.Getenv("CHROMIUM_PATH")
 
-// Reference to browser context, initialized in init function of this package.
-var browserCtx context.Context
+// Printer used by the functions of the package, created by StartBrowser().
+var defaultPrinter *Printer
 
-// Allocate a browser to be reused by multiple invocations, to reduce startup time. Cancelling the context will close the browser.
-// This function must be called before starting to print PDFs.
+// Allocate a pool of browsers to be reused by multiple invocations, to reduce startup time. Cancelling the context will close the browsers.
+// The default printer is configured from the variables of the package, such as ChromiumPath, PoolSize, MaxTabs and QueueTimeout, when this
+// function is called. This function must be called before starting to print PDFs with the functions of the package.
 func StartBrowser(ctx context.Context) error {
 	if Running() {
 		return nil
@@ -167,25 +252,40 @@ func StartBrowser(ctx context.Context) error {
 		return fmt.Errorf("missing required environment variable CHROMIUM_PATH")
 	}
 
-	defer Elapsed("Browser startup")()
-	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.ExecPath(ChromiumPath))
-	allocatorCtx, _ := chromedp.NewExecAllocator(ctx, opts...)
-	browserCtx, _ = chromedp.NewContext(allocatorCtx)
+	opts := []Option{
+		WithChromiumPath(ChromiumPath),
+		WithPoolSize(PoolSize),
+		WithMaxTabs(MaxTabs),
+		WithQueueTimeout(QueueTimeout),
+		WithRestartBackoff(RestartBackoff, MaxRestartBackoff),
+		WithDefaultBlock(DefaultBlock),
+		WithDefaultAssets(DefaultStyles, DefaultScripts),
+		WithAllowDocumentUrl(AllowDocumentUrl),
+	}
+	if DenyPrivateNetworks {
+		opts = append(opts, WithDenyPrivateNetworks(AllowedNetworks...))
+	}
 
-	// Navigate to blank page so that the browser is started.
-	err := chromedp.Run(browserCtx, chromedp.Tasks{chromedp.Navigate("about:blank")})
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error initializing browser: %v", err)
+	if defaultPrinter != nil {
+		// Close browsers of a previous start which are restarting, before replacing them.
+		if err := defaultPrinter.Close(); err != nil {
+			return err
+		}
+		defaultPrinter = nil
+	}
 
+	p := NewPrinter(opts...)
+	if err := p.Start(ctx); err != nil {
 		return err
 	}
+	defaultPrinter = p
 
 	return nil
 }
 
 // Check if the browser is still running.
 func Running() bool {
-	return browserCtx != nil && browserCtx.Err() == nil
+	return defaultPrinter != nil && defaultPrinter.Running()
 }
 
 // Get print format dimensions from string name.
@@ -203,6 +303,80 @@ func getFormat(format string) (PrintFormat, error) {
 	return f, nil
 }
 
+// Validate the source of the document to print, which is either a URL or HTML content.
+func validateSource(data GetPDFParams) error {
+	if data.Url == "" && data.Html == "" {
+		return NewValidationError("one of url or html is required")
+	}
+	if data.Url != "" && data.Html != "" {
+		return NewValidationError("url and html cannot be used together")
+	}
+	if data.BaseUrl != "" {
+		if data.Html == "" {
+			return NewValidationError("base_url can only be used together with html")
+		}
+
+		u, err := url.Parse(data.BaseUrl)
+		if err != nil || !slices.Contains([]string{"http", "https"}, u.Scheme) || u.Host == "" {
+			return NewValidationError(fmt.Sprintf("invalid base_url \"%s\", must be an absolute HTTP or HTTPS URL", data.BaseUrl))
+		}
+	}
+
+	return nil
+}
+
+// Get the URL the document will be loaded from: either Url, or BaseUrl when printing HTML content. May be empty.
+func (data GetPDFParams) DocumentUrl() string {
+	if data.Html != "" {
+		return data.BaseUrl
+	}
+
+	return data.Url
+}
+
+// Load the document to print in the tab, either navigating to its URL or replacing the content of the blank page.
+// Return the loader of the navigation, which is empty if the content was replaced in place.
+func loadDocument(ctx context.Context, data GetPDFParams) (_ cdp.LoaderID, err error) {
+	if data.Html != "" && data.BaseUrl == "" {
+		ctx, end := startPhase(ctx, "load_html")
+		defer end(&err)
+
+		// Leave the document previously loaded in the tab, if any, so the content does not run with its origin and storage.
+		if _, _, _, _, err := page.Navigate("about:blank").Do(ctx); err != nil {
+			return "", err
+		}
+		tree, err := page.GetFrameTree().Do(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		return "", page.SetDocumentContent(tree.Frame.ID, data.Html).Do(ctx)
+	}
+
+	target := data.DocumentUrl()
+	ctx, end := startPhase(ctx, "navigate", attribute.String("url", target))
+	defer end(&err)
+
+	_, loaderID, errorText, _, err := page.Navigate(target).Do(ctx)
+	if err != nil {
+		return "", err
+	} else if errorText != "" {
+		return "", fmt.Errorf("page load error %s", errorText)
+	}
+
+	return loaderID, nil
+}
+
+// Convert a length parameter to inches, mentioning its name in validation errors.
+func getLength(name string, l Length) (float64, error) {
+	inches, err := l.Inches()
+	if err != nil {
+		return 0, NewValidationError(fmt.Sprintf("%s: %s", name, err))
+	}
+
+	return inches, nil
+}
+
 // Prepare chromedp's print parameters from provider parameters, with defaults.
 // Return an error if validation of any parameter fails.
 func getPrintParams(data GetPDFParams) (page.PrintToPDFParams, error) {
@@ -217,16 +391,34 @@ func getPrintParams(data GetPDFParams) (page.PrintToPDFParams, error) {
 		GenerateDocumentOutline: false,
 	}
 
-	formatName := "A4"
-	if data.Format != "" {
-		formatName = data.Format
-	}
-	format, err := getFormat(formatName)
-	if err != nil {
-		return page.PrintToPDFParams{}, err
+	var err error
+	if data.Width != "" || data.Height != "" {
+		if data.Width == "" || data.Height == "" {
+			return page.PrintToPDFParams{}, NewValidationError("width and height must be provided together")
+		}
+
+		if params.PaperWidth, err = getLength("width", data.Width); err != nil {
+			return page.PrintToPDFParams{}, err
+		}
+		if params.PaperHeight, err = getLength("height", data.Height); err != nil {
+			return page.PrintToPDFParams{}, err
+		}
+		if params.PaperWidth == 0 || params.PaperHeight == 0 {
+			return page.PrintToPDFParams{}, NewValidationError("width and height must be greater than zero")
+		}
+	} else {
+		formatName := "A4"
+		if data.Format != "" {
+			formatName = data.Format
+		}
+		format, err := getFormat(formatName)
+		if err != nil {
+			return page.PrintToPDFParams{}, err
+		}
+		params.PaperWidth = format.Width
+		params.PaperHeight = format.Height
 	}
-	params.PaperWidth = format.Width
-	params.PaperHeight = format.Height
+	params.PreferCSSPageSize = data.PreferCSSPageSize
 
 	if data.Background != nil {
 		params.PrintBackground = *data.Background
@@ -241,141 +433,84 @@ func getPrintParams(data GetPDFParams) (page.PrintToPDFParams, error) {
 	}
 
 	if data.Margins != nil {
-		params.MarginTop = data.Margins.Top
-		params.MarginBottom = data.Margins.Bottom
-		params.MarginLeft = data.Margins.Left
-		params.MarginRight = data.Margins.Right
-	}
-
-	if data.Scale != 0 {
-		if data.Scale < 0 {
-			return page.PrintToPDFParams{}, NewValidationError("scale must be a positive decimal number")
+		margins := []struct {
+			name   string
+			length Length
+			dest   *float64
+		}{
+			{"margin.top", data.Margins.Top, &params.MarginTop},
+			{"margin.bottom", data.Margins.Bottom, &params.MarginBottom},
+			{"margin.left", data.Margins.Left, &params.MarginLeft},
+			{"margin.right", data.Margins.Right, &params.MarginRight},
+		}
+		for _, m := range margins {
+			*m.dest = 0
+			if m.length == "" {
+				continue
+			}
+			if *m.dest, err = getLength(m.name, m.length); err != nil {
+				return page.PrintToPDFParams{}, err
+			}
 		}
-
-		params.Scale = data.Scale
 	}
 
-	return params, nil
-}
-
-// Print a webpage in PDF format and write the result to the input handler. Cancelling the context will close the tab.
-// StartBrowser() must have been called once before calling this function.
-func PrintPDF(ctx context.Context, data GetPDFParams, h PDFHandler) (string, error) {
-	if browserCtx == nil {
-		return "", fmt.Errorf("must call StartBrowser() before printing a PDF")
+	// Chromium swaps width and height when printing in landscape.
+	width, height := params.PaperWidth, params.PaperHeight
+	if params.Landscape {
+		width, height = height, width
 	}
-
-	defer Elapsed("Total time to print PDF")()
-
-	params, err := getPrintParams(data)
-	if err != nil {
-		return "", err
+	if params.MarginLeft+params.MarginRight >= width || params.MarginTop+params.MarginBottom >= height {
+		return page.PrintToPDFParams{}, NewValidationError("margins must be smaller than the page size")
 	}
 
-	media := "print"
-	if data.Media != "" {
-		if !slices.Contains([]string{"screen", "print"}, data.Media) {
-			return "", NewValidationError(fmt.Sprintf("invalid media value \"%s\", valid media values are: screen, print", data.Media))
+	if data.Scale != 0 {
+		if data.Scale < 0 {
+			return page.PrintToPDFParams{}, NewValidationError("scale must be a positive decimal number")
 		}
 
-		media = data.Media
+		params.Scale = data.Scale
 	}
 
-	tabCtx, tabCancel := chromedp.NewContext(browserCtx, chromedp.WithNewBrowserContext())
-	defer tabCancel()
-	// Cancel the tab context (closing the tab) if the passed context is canceled.
-	context.AfterFunc(ctx, tabCancel)
-
-	interactiveReached := false
-	idleReached := false
-	res := ""
-	err = chromedp.Run(tabCtx, chromedp.Tasks{
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			defer Elapsed(fmt.Sprintf("Forward cookies (%s)", slices.Collect(maps.Keys(data.Cookies))))()
+	if data.HeaderTemplate != "" || data.FooterTemplate != "" {
+		// An empty element is used in place of a missing template, otherwise Chromium would print its default one.
+		params.DisplayHeaderFooter = true
+		params.HeaderTemplate = "<span></span>"
+		params.FooterTemplate = "<span></span>"
 
-			u, err := url.Parse(data.Url)
+		if data.HeaderTemplate != "" {
+			params.HeaderTemplate, err = getTemplate("header_template", data.HeaderTemplate)
 			if err != nil {
-				return fmt.Errorf("parsing URL error: %w", err)
-			}
-
-			for name, value := range data.Cookies {
-				expr := cdp.TimeSinceEpoch(time.Now().Add(180 * 24 * time.Hour))
-
-				err := network.SetCookie(name, value).
-					WithExpires(&expr).
-					WithDomain(u.Hostname()).
-					WithPath("/").
-					WithHTTPOnly(true).
-					WithSecure(false).
-					Do(ctx)
-				if err != nil {
-					return fmt.Errorf("failed to set cookie %s: %w", name, err)
-				}
-			}
-
-			return nil
-		}),
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			defer Elapsed(fmt.Sprintf("Navigate to %s", data.Url))()
-
-			if err := chromedp.Navigate(data.Url).Do(ctx); err != nil {
-				return err
+				return page.PrintToPDFParams{}, err
 			}
-
-			// Wait for both "InteractiveTime" and "networkIdle" events.
-			ch := make(chan struct{})
-			wCtx, cancel := context.WithCancel(ctx)
-			chromedp.ListenTarget(wCtx, func(ev interface{}) {
-				switch ev := ev.(type) {
-				case *page.EventLifecycleEvent:
-					if ev.Name == "InteractiveTime" {
-						interactiveReached = true
-					}
-					if ev.Name == "networkIdle" {
-						idleReached = true
-					}
-					if interactiveReached && idleReached {
-						cancel()
-						close(ch)
-					}
-				}
-			})
-
-			select {
-			case <-ch:
-				return nil
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-		}),
-		chromedp.ActionFunc(func(ctx context.Context) error {
-			defer Elapsed("Export as PDF")()
-
-			err := emulation.SetEmulatedMedia().WithMedia(media).Do(ctx)
+		}
+		if data.FooterTemplate != "" {
+			params.FooterTemplate, err = getTemplate("footer_template", data.FooterTemplate)
 			if err != nil {
-				return err
+				return page.PrintToPDFParams{}, err
 			}
+		}
+	}
 
-			_, stream, err := params.WithTransferMode(page.PrintToPDFTransferModeReturnAsStream).Do(ctx)
-			if err != nil {
-				return err
-			}
+	return params, nil
+}
 
-			sh := NewStreamHandleReader(ctx, stream)
-			res, err = h.Handle(sh)
-			if err != nil {
-				return err
-			}
-			if err := sh.Close(); err != nil {
-				return err
-			}
+// Print a webpage, or HTML content, in PDF format, or capture it as an image according to the Output parameter,
+// and write the result to the input handler. Cancelling the context will close the tab.
+// If all browsers are busy, waits up to QueueTimeout for a free tab, then returns ErrQueueTimeout.
+// If the browser exits before the PDF is passed to the handler, the print is retried once on a restarted browser.
+// StartBrowser() must have been called once before calling this function.
+func PrintPDF(ctx context.Context, data GetPDFParams, h PDFHandler) (string, error) {
+	res, _, err := PrintPDFWithDiagnostics(ctx, data, h)
 
-			return nil
-		}),
-	})
-	if err != nil {
-		return "", err
+	return res, err
+}
+
+// Same as PrintPDF(), also returning the diagnostics of the document, such as console messages, uncaught exceptions
+// and failed requests. Diagnostics are returned on error too, unless the document was never loaded.
+func PrintPDFWithDiagnostics(ctx context.Context, data GetPDFParams, h PDFHandler) (string, *Diagnostics, error) {
+	if defaultPrinter == nil {
+		return "", nil, fmt.Errorf("must call StartBrowser() before printing a PDF")
 	}
 
-	return res, nil
+	return defaultPrinter.PrintWithDiagnostics(ctx, data, h)
 }
@@ -0,0 +1,327 @@
+package print2pdf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// A printer of documents, with its own pool of Chromium processes and configuration. Several printers can be used in
+// the same process. Create it with NewPrinter(), then call Start() before printing.
+type Printer struct {
+	chromiumPath        string
+	flags               []chromedp.ExecAllocatorOption
+	logger              *slog.Logger
+	poolSize            int
+	maxTabs             int
+	queueTimeout        time.Duration
+	restartBackoff      time.Duration
+	maxRestartBackoff   time.Duration
+	defaultBlock        BlockParams
+	defaultStyles       []string
+	defaultScripts      []string
+	denyPrivateNetworks bool
+	allowedNetworks     []netip.Prefix
+	allowDocumentUrl    func(u string) error
+	defaultParams       GetPDFParams
+
+	mu     sync.Mutex
+	pool   *browserPool
+	cancel context.CancelFunc
+}
+
+// Option configuring a Printer.
+type Option func(p *Printer)
+
+// Create a new printer. Without options, it starts one Chromium process found in the PATH, with up to 10 concurrent
+// tabs, and prints wait up to 30 seconds for a free tab.
+func NewPrinter(opts ...Option) *Printer {
+	p := &Printer{
+		poolSize:          1,
+		maxTabs:           10,
+		queueTimeout:      30 * time.Second,
+		restartBackoff:    time.Second,
+		maxRestartBackoff: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Set the path of the Chromium binary. Default is empty, meaning Chromium or Chrome is looked up in the PATH.
+func WithChromiumPath(path string) Option {
+	return func(p *Printer) {
+		p.chromiumPath = path
+	}
+}
+
+// Set a command line flag of Chromium, in addition to or in place of the default ones of chromedp. Use false as value
+// to remove a default flag.
+func WithChromiumFlag(name string, value any) Option {
+	return func(p *Printer) {
+		p.flags = append(p.flags, chromedp.Flag(name, value))
+	}
+}
+
+// Set the logger of the printer, used unless a logger is set in the context of a print with ContextWithLogger().
+// Default is nil, meaning the package Logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(p *Printer) {
+		p.logger = l
+	}
+}
+
+// Set the number of Chromium processes to start. Default is 1.
+func WithPoolSize(size int) Option {
+	return func(p *Printer) {
+		p.poolSize = size
+	}
+}
+
+// Set the maximum number of concurrent tabs for each Chromium process. Zero means no limit. Default is 10.
+func WithMaxTabs(tabs int) Option {
+	return func(p *Printer) {
+		p.maxTabs = tabs
+	}
+}
+
+// Set the maximum time a print waits for a free tab when all browsers are busy, after which it fails with
+// ErrQueueTimeout. Zero means no limit. Default is 30 seconds.
+func WithQueueTimeout(timeout time.Duration) Option {
+	return func(p *Printer) {
+		p.queueTimeout = timeout
+	}
+}
+
+// Set the delay before the first restart attempt of a browser that exited shortly after starting, doubled after every
+// failed attempt up to the maximum. Default is 1 second, up to 1 minute.
+func WithRestartBackoff(initial, maximum time.Duration) Option {
+	return func(p *Printer) {
+		p.restartBackoff = initial
+		p.maxRestartBackoff = maximum
+	}
+}
+
+// Set the requests blocked when loading every document, in addition to the Block parameter of each print.
+func WithDefaultBlock(block BlockParams) Option {
+	return func(p *Printer) {
+		p.defaultBlock = block
+	}
+}
+
+// Set the styles and scripts injected in every document, before the Styles and Scripts parameters of each print.
+// They are not subject to the size limit of print parameters. See LoadAssets().
+func WithDefaultAssets(styles, scripts []string) Option {
+	return func(p *Printer) {
+		p.defaultStyles = styles
+		p.defaultScripts = scripts
+	}
+}
+
+// Deny requests made by documents to loopback, private, link-local and cloud metadata addresses, except for the
+// allowed networks. See DenyPrivateNetworks.
+func WithDenyPrivateNetworks(allowed ...netip.Prefix) Option {
+	return func(p *Printer) {
+		p.denyPrivateNetworks = true
+		p.allowedNetworks = allowed
+	}
+}
+
+// Check the URL of every document loaded in the page and in its frames, including every redirect. See AllowDocumentUrl.
+func WithAllowDocumentUrl(allow func(u string) error) Option {
+	return func(p *Printer) {
+		p.allowDocumentUrl = allow
+	}
+}
+
+// Set the parameters used by every print for the fields it leaves empty, e.g. the format, margins or signer. Boolean
+// fields set to true cannot be unset by a print. Headers are added to the ones of the print, which take precedence.
+// The document fields Url, Html, BaseUrl and FileName are ignored. For merged PDFs, Metadata, Security, Archival,
+// Signature and Signer apply to the merged PDF, the others to its parts.
+func WithDefaultParams(params GetPDFParams) Option {
+	return func(p *Printer) {
+		p.defaultParams = params
+	}
+}
+
+// Start the pool of browsers of the printer, to be reused by multiple prints. Cancelling the context, or calling
+// Close(), will close the browsers. Does nothing if the printer is already running, otherwise browsers of a previous
+// start which are restarting are closed first.
+func (p *Printer) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pool != nil && p.pool.running() {
+		return nil
+	}
+	p.close()
+	if _, err := newBlocker(&p.defaultBlock); err != nil {
+		return fmt.Errorf("invalid default block: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(p.withLogger(ctx))
+	pool, err := newBrowserPool(ctx, p)
+	if err != nil {
+		cancel()
+		logger(ctx).ErrorContext(ctx, "error initializing browser", "error", err)
+
+		return err
+	}
+	p.pool, p.cancel = pool, cancel
+	startedPrinters.Store(p, struct{}{})
+
+	return nil
+}
+
+// Check if at least one browser of the printer is running.
+func (p *Printer) Running() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pool != nil && p.pool.running()
+}
+
+// Close the browsers of the printer. Prints in progress fail. The printer can be started again.
+func (p *Printer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.close()
+
+	return nil
+}
+
+// Close the pool of browsers, if any. Must be called with the lock held.
+func (p *Printer) close() {
+	if p.pool == nil {
+		return
+	}
+
+	p.cancel()
+	p.pool.close()
+	p.pool, p.cancel = nil, nil
+	startedPrinters.Delete(p)
+}
+
+// Print a webpage, or HTML content, and write the result to the handler. See PrintPDF().
+func (p *Printer) Print(ctx context.Context, data GetPDFParams, h PDFHandler) (string, error) {
+	res, _, err := p.PrintWithDiagnostics(ctx, data, h)
+
+	return res, err
+}
+
+// Same as Print(), also returning the diagnostics of the document. See PrintPDFWithDiagnostics().
+func (p *Printer) PrintWithDiagnostics(ctx context.Context, data GetPDFParams, h PDFHandler) (_ string, _ *Diagnostics, err error) {
+	pool, err := p.startedPool()
+	if err != nil {
+		return "", nil, err
+	}
+
+	ctx = withPrintLogger(p.withLogger(ctx), data)
+	ctx, end := startPhase(ctx, "print", attribute.String("file_name", data.FileName))
+	defer end(&err)
+	start := time.Now()
+	activePrints.Add(ctx, 1)
+	defer activePrints.Add(ctx, -1)
+	defer func() {
+		if err != nil {
+			recordFailure(ctx, err)
+		}
+	}()
+
+	job, err := p.newPrintJob(p.withDefaults(data))
+	if err != nil {
+		return "", nil, err
+	}
+
+	res := ""
+	handled := false
+	var diag *Diagnostics
+	err = pool.runInTab(ctx, func(ctx context.Context) error {
+		var err error
+		diag, err = job.run(ctx, func(ctx context.Context, r io.Reader) error {
+			handled = true
+			res, err = handle(ctx, h, r, job.output)
+
+			return err
+		})
+
+		return err
+	}, &handled)
+	if err != nil {
+		return "", diag, err
+	}
+
+	logger(ctx).InfoContext(ctx, "print completed", "output", job.output, durationMs(time.Since(start)))
+
+	return res, diag, nil
+}
+
+// Fields of the print parameters which identify the document, and never take a default value.
+var documentFields = []string{"Url", "Html", "BaseUrl", "FileName"}
+
+// Fields of the print parameters set on the merged PDF instead of on its parts.
+var mergedFields = []string{"Output", "Metadata", "Security", "Archival", "Signature", "Signer"}
+
+// Fill the empty fields of the print parameters with the default parameters of the printer, except for the skipped ones.
+func (p *Printer) withDefaults(data GetPDFParams, skip ...string) GetPDFParams {
+	defaults := reflect.ValueOf(p.defaultParams)
+	v := reflect.ValueOf(&data).Elem()
+	for i := range v.NumField() {
+		name := v.Type().Field(i).Name
+		if slices.Contains(documentFields, name) || slices.Contains(skip, name) {
+			continue
+		}
+		if f := v.Field(i); f.IsZero() {
+			f.Set(defaults.Field(i))
+		}
+	}
+	data.Headers = mergeHeaders(p.defaultParams.Headers, data.Headers)
+
+	return data
+}
+
+// Get the pool of browsers, failing if the printer was not started.
+func (p *Printer) startedPool() (*browserPool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pool == nil {
+		return nil, fmt.Errorf("must call Start() before printing a PDF")
+	}
+
+	return p.pool, nil
+}
+
+// Add the logger of the printer to a context, unless it already carries one.
+func (p *Printer) withLogger(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok || p.logger == nil {
+		return ctx
+	}
+
+	return ContextWithLogger(ctx, p.logger)
+}
+
+// Collect statistics about the pool of the printer: running browsers, tabs in use and waiting prints.
+func (p *Printer) stats() (browsers, tabs, waiting int) {
+	p.mu.Lock()
+	pool := p.pool
+	p.mu.Unlock()
+
+	if pool == nil {
+		return 0, 0, 0
+	}
+
+	return pool.stats()
+}
@@ -0,0 +1,40 @@
+package print2pdf
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestWithDefaultParams(t *testing.T) {
+	p := NewPrinter(WithDefaultParams(GetPDFParams{
+		Url:       "https://example.com/default",
+		FileName:  "default.pdf",
+		Format:    "A4",
+		Scale:     0.8,
+		Media:     "screen",
+		Headers:   map[string]string{"Accept-Language": "it", "X-Tenant": "default"},
+		Archival:  "pdfa-2b",
+		Watermark: &WatermarkParams{Text: "DRAFT"},
+	}))
+
+	data := p.withDefaults(GetPDFParams{
+		Html:     "<p>Hello</p>",
+		FileName: "hello.pdf",
+		Format:   "Letter",
+		Headers:  map[string]string{"x-tenant": "print"},
+	})
+	if data.Url != "" || data.FileName != "hello.pdf" {
+		t.Errorf("document fields must not take default values, got url %q and file name %q", data.Url, data.FileName)
+	}
+	if data.Format != "Letter" || data.Media != "screen" || data.Scale != 0.8 || data.Archival != "pdfa-2b" {
+		t.Errorf("expected empty fields to take default values, got %+v", data)
+	}
+	if expected := map[string]string{"Accept-Language": "it", "x-tenant": "print"}; !maps.Equal(data.Headers, expected) {
+		t.Errorf("expected headers %v, got %v", expected, data.Headers)
+	}
+
+	part := p.withDefaults(GetPDFParams{Url: "https://example.com/part"}, mergedFields...)
+	if part.Archival != "" || part.Watermark == nil {
+		t.Errorf("expected merged fields to be skipped for parts, got archival %q and watermark %v", part.Archival, part.Watermark)
+	}
+}
@@ -0,0 +1,87 @@
+package print2pdf
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/chromedp/cdproto/page"
+)
+
+// Options for capturing a screenshot, used when the output is an image format.
+type ScreenshotParams struct {
+	// Capture the whole page instead of just the viewport. Ignored if Clip is provided. Default is false.
+	FullPage bool `json:"full_page,omitempty"`
+	// Compression quality, from 0 to 100. Only supported by "jpeg" and "webp" outputs. Default is decided by Chromium.
+	Quality *int `json:"quality,omitempty"`
+	// Region of the page to capture. Default is the viewport, or the whole page if FullPage is true.
+	Clip *ScreenshotClip `json:"clip,omitempty"`
+}
+
+// Region of the page to capture, in CSS pixels.
+type ScreenshotClip struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Validate screenshot options for the given output.
+func validateScreenshot(output string, s *ScreenshotParams) error {
+	if s == nil {
+		return nil
+	}
+	if output == "pdf" {
+		return NewValidationError("screenshot options can only be used with an image output")
+	}
+
+	if s.Quality != nil {
+		if output == "png" {
+			return NewValidationError("screenshot quality is not supported by png output")
+		}
+		if *s.Quality < 0 || *s.Quality > 100 {
+			return NewValidationError("screenshot quality must be a number between 0 and 100")
+		}
+	}
+
+	if s.Clip != nil {
+		if s.Clip.X < 0 || s.Clip.Y < 0 {
+			return NewValidationError("screenshot clip coordinates must not be negative")
+		}
+		if s.Clip.Width <= 0 || s.Clip.Height <= 0 {
+			return NewValidationError("screenshot clip width and height must be greater than zero")
+		}
+	}
+
+	return nil
+}
+
+// Capture a screenshot of the page in the given image format.
+func captureScreenshot(ctx context.Context, output string, s *ScreenshotParams) ([]byte, error) {
+	if s == nil {
+		s = &ScreenshotParams{}
+	}
+
+	params := page.CaptureScreenshot().WithFormat(page.CaptureScreenshotFormat(output))
+	if s.Quality != nil {
+		params = params.WithQuality(int64(*s.Quality))
+	}
+
+	switch {
+	case s.Clip != nil:
+		params = params.
+			WithCaptureBeyondViewport(true).
+			WithClip(&page.Viewport{X: s.Clip.X, Y: s.Clip.Y, Width: s.Clip.Width, Height: s.Clip.Height, Scale: 1})
+	case s.FullPage:
+		_, _, _, _, _, contentSize, err := page.GetLayoutMetrics().Do(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting page size: %w", err)
+		}
+
+		params = params.
+			WithCaptureBeyondViewport(true).
+			WithClip(&page.Viewport{Width: math.Ceil(contentSize.Width), Height: math.Ceil(contentSize.Height), Scale: 1})
+	}
+
+	return params.Do(ctx)
+}
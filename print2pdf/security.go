@@ -0,0 +1,104 @@
+package print2pdf
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// A sensitive string, such as a password, which is redacted when formatted or logged.
+type Secret string
+
+// Placeholder used in place of the value of a secret when it is formatted or logged.
+const redacted = "[REDACTED]"
+
+// Redact the secret when formatted with %s and %v verbs.
+func (s Secret) String() string {
+	return redacted
+}
+
+// Redact the secret when formatted with the %#v verb.
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// Redact the secret when logged with log/slog.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+// Get the actual value of the secret.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// Maximum length of a password, as supported by AES-256 encryption.
+const maxPasswordLength = 127
+
+// Permissions that can be granted to users opening an encrypted PDF with the user password.
+var PermissionsMap = map[string]model.PermissionFlags{
+	"print":  model.PermissionPrintRev2 | model.PermissionPrintRev3,
+	"copy":   model.PermissionExtract | model.PermissionExtractRev3,
+	"modify": model.PermissionModify | model.PermissionModAnnFillForm | model.PermissionFillRev3 | model.PermissionAssembleRev3,
+}
+
+// Options for encrypting the generated PDF with AES-256.
+type SecurityParams struct {
+	// Password required to open the document. Default is empty, meaning the document can be opened by anyone but
+	// permissions are still enforced.
+	UserPassword Secret `json:"user_password,omitempty"`
+	// Password granting full access to the document, regardless of permissions. Required.
+	OwnerPassword Secret `json:"owner_password"`
+	// Permissions granted to users opening the document with the user password. See PermissionsMap for valid values.
+	// Default is empty, meaning no permissions.
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// Validate security options for the given output.
+func validateSecurity(output string, s *SecurityParams) error {
+	if s == nil {
+		return nil
+	}
+	if output != "pdf" {
+		return NewValidationError("security can only be used with pdf output")
+	}
+
+	if s.OwnerPassword == "" {
+		return NewValidationError("security owner password is required")
+	}
+	if s.OwnerPassword == s.UserPassword {
+		return NewValidationError("security owner and user passwords must be different")
+	}
+	if len(s.OwnerPassword) > maxPasswordLength || len(s.UserPassword) > maxPasswordLength {
+		return NewValidationError(fmt.Sprintf("security passwords are too long, maximum is %d bytes", maxPasswordLength))
+	}
+
+	for _, p := range s.Permissions {
+		if _, ok := PermissionsMap[p]; !ok {
+			return NewValidationError(fmt.Sprintf("invalid security permission \"%s\", valid permissions are: %s", p, strings.Join(slices.Sorted(maps.Keys(PermissionsMap)), ", ")))
+		}
+	}
+
+	return nil
+}
+
+// Encrypt the document with AES-256 when it is written. Must be the last modification applied to the document.
+func applySecurity(ctx *model.Context, s SecurityParams) error {
+	permissions := model.PermissionsNone
+	for _, p := range s.Permissions {
+		permissions |= PermissionsMap[p]
+	}
+
+	ctx.Cmd = model.ENCRYPT
+	ctx.UserPW = s.UserPassword.Reveal()
+	ctx.OwnerPW = s.OwnerPassword.Reveal()
+	ctx.EncryptUsingAES = true
+	ctx.EncryptKeyLength = 256
+	ctx.Permissions = permissions
+
+	return nil
+}
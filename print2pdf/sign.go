@@ -0,0 +1,393 @@
+package print2pdf
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Certificate and private key used to digitally sign PDFs, with an optional timestamp authority.
+type Signer struct {
+	// Signing certificate.
+	Certificate *x509.Certificate
+	// Intermediate certificates, embedded in the signature to help validation.
+	Chain []*x509.Certificate
+	// Private key of the signing certificate. Only RSA and ECDSA keys are supported.
+	Key crypto.Signer
+	// URL of an RFC 3161 timestamp authority, used to add a trusted timestamp to signatures. Default is empty, meaning
+	// signatures are not timestamped.
+	TimestampUrl string
+	// Root certificates trusted for the certificate of the timestamp authority, which signs timestamp tokens. Default is
+	// nil, meaning the system roots.
+	TimestampRoots *x509.CertPool
+}
+
+// Describe the signer by its certificate, without revealing the private key when formatted or logged.
+func (s *Signer) String() string {
+	return fmt.Sprintf("Signer(%s)", s.Certificate.Subject)
+}
+
+// Load a signer from PKCS#12 data, or from PEM data containing the certificate, its chain and the unencrypted private key.
+// The password is only used for PKCS#12 data.
+func LoadSigner(data []byte, password Secret) (*Signer, error) {
+	var key any
+	var certs []*x509.Certificate
+	if block, _ := pem.Decode(data); block == nil {
+		k, cert, chain, err := pkcs12.DecodeChain(data, password.Reveal())
+		if err != nil {
+			return nil, fmt.Errorf("error decoding PKCS#12 data: %w", err)
+		}
+
+		key, certs = k, append([]*x509.Certificate{cert}, chain...)
+	} else {
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			var err error
+			switch block.Type {
+			case "CERTIFICATE":
+				var cert *x509.Certificate
+				if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+					certs = append(certs, cert)
+				}
+			case "PRIVATE KEY":
+				key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+			case "RSA PRIVATE KEY":
+				key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+			case "EC PRIVATE KEY":
+				key, err = x509.ParseECPrivateKey(block.Bytes)
+			case "ENCRYPTED PRIVATE KEY":
+				err = errors.New("encrypted private keys are not supported, use PKCS#12 instead")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error decoding PEM block %s: %w", block.Type, err)
+			}
+		}
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("missing or unsupported private key")
+	}
+	switch signer.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("unsupported private key type, only RSA and ECDSA keys are supported")
+	}
+
+	s := &Signer{Key: signer}
+	for _, cert := range certs {
+		if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); ok && s.Certificate == nil && pub.Equal(cert.PublicKey) {
+			s.Certificate = cert
+		} else {
+			s.Chain = append(s.Chain, cert)
+		}
+	}
+	if s.Certificate == nil {
+		return nil, errors.New("missing certificate matching the private key")
+	}
+	if time.Now().After(s.Certificate.NotAfter) {
+		return nil, fmt.Errorf("certificate expired on %s", s.Certificate.NotAfter.Format(time.DateOnly))
+	}
+
+	return s, nil
+}
+
+// Options for digitally signing the generated PDF with a PAdES baseline signature.
+type SignatureParams struct {
+	// Reason for signing. Default is empty.
+	Reason string `json:"reason,omitempty"`
+	// Location of signing. Default is empty.
+	Location string `json:"location,omitempty"`
+	// Contact information of the signer. Default is empty.
+	ContactInfo string `json:"contact_info,omitempty"`
+	// Visible box showing the signer and the signing time. Default is nil, meaning the signature is invisible.
+	Box *SignatureBox `json:"box,omitempty"`
+}
+
+// Position and size of a visible signature.
+type SignatureBox struct {
+	// Page number, starting from 1. Default is 1.
+	Page int `json:"page,omitempty"`
+	// Distance from the left edge of the page.
+	X Length `json:"x"`
+	// Distance from the top edge of the page.
+	Y Length `json:"y"`
+	// Width of the box. Required.
+	Width Length `json:"width"`
+	// Height of the box. Required.
+	Height Length `json:"height"`
+}
+
+// Maximum length of the textual fields of a signature.
+const maxSignatureFieldLength = 256
+
+// Validate signature options for the given output.
+func validateSignature(output string, s *SignatureParams, signer *Signer) error {
+	if s == nil {
+		return nil
+	}
+	if output != "pdf" {
+		return NewValidationError("signature can only be used with pdf output")
+	}
+	if signer == nil {
+		return NewValidationError("signature is not available, as no signing certificate is configured")
+	}
+
+	for name, value := range map[string]string{"reason": s.Reason, "location": s.Location, "contact info": s.ContactInfo} {
+		if len(value) > maxSignatureFieldLength {
+			return NewValidationError(fmt.Sprintf("signature %s is too long, maximum is %d bytes", name, maxSignatureFieldLength))
+		}
+	}
+
+	if s.Box != nil {
+		if s.Box.Page < 0 {
+			return NewValidationError("signature box page must be a positive number")
+		}
+		for name, l := range map[string]Length{"x": s.Box.X, "y": s.Box.Y, "width": s.Box.Width, "height": s.Box.Height} {
+			v, err := l.Inches()
+			if err != nil {
+				return NewValidationError(fmt.Sprintf("invalid signature box %s: %s", name, err))
+			}
+			if v < 0 || (v == 0 && (name == "width" || name == "height")) {
+				return NewValidationError(fmt.Sprintf("signature box %s must be greater than zero", name))
+			}
+		}
+	}
+
+	return nil
+}
+
+// Placeholder of the byte range of a signature, replaced once the position of the signature in the document is known.
+var byteRangePlaceholder = types.Array{types.Integer(0), types.Integer(9999999999), types.Integer(9999999999), types.Integer(9999999999)}
+
+// Size in bytes reserved for the CMS signature, depending on the certificates and on the timestamp.
+func signatureSize(signer *Signer) int {
+	size := 4096 + len(signer.Certificate.Raw)
+	for _, cert := range signer.Chain {
+		size += len(cert.Raw)
+	}
+	if signer.TimestampUrl != "" {
+		size += 16384
+	}
+
+	return size
+}
+
+// Add an empty signature field to the document, with placeholders for the byte range and the signature value, which are
+// filled in by signPDF() once the document is written. Object streams are disabled, so placeholders can be found.
+func applySignature(ctx *model.Context, s SignatureParams, signer *Signer) error {
+	ctx.WriteObjectStream = false
+
+	now := time.Now()
+	v := types.NewDict()
+	v.InsertName("Type", "Sig")
+	v.InsertName("Filter", "Adobe.PPKLite")
+	v.InsertName("SubFilter", "ETSI.CAdES.detached")
+	v.Insert("ByteRange", byteRangePlaceholder)
+	v.Insert("Contents", types.HexLiteral(strings.Repeat("00", signatureSize(signer))))
+	v.InsertString("M", types.DateString(now))
+	for key, value := range map[string]string{"Reason": s.Reason, "Location": s.Location, "ContactInfo": s.ContactInfo} {
+		if value == "" {
+			continue
+		}
+
+		str, err := types.EscapedUTF16String(value)
+		if err != nil {
+			return err
+		}
+		v.Insert(key, types.StringLiteral(*str))
+	}
+	vRef, err := ctx.IndRefForNewObject(v)
+	if err != nil {
+		return err
+	}
+
+	pageNr := 1
+	if s.Box != nil && s.Box.Page > 0 {
+		pageNr = s.Box.Page
+	}
+	if pageNr > ctx.PageCount {
+		return NewValidationError(fmt.Sprintf("signature box page %d does not exist, the document has %d pages", pageNr, ctx.PageCount))
+	}
+	page, pageRef, inherited, err := ctx.PageDict(pageNr, false)
+	if err != nil {
+		return fmt.Errorf("error reading page %d: %w", pageNr, err)
+	}
+
+	root, err := ctx.Catalog()
+	if err != nil {
+		return fmt.Errorf("error reading document catalog: %w", err)
+	}
+	form, err := ctx.DereferenceDict(root["AcroForm"])
+	if err != nil {
+		return fmt.Errorf("error reading document form: %w", err)
+	}
+	if form == nil {
+		form = types.NewDict()
+		root.Update("AcroForm", form)
+	}
+	fields, err := ctx.DereferenceArray(form["Fields"])
+	if err != nil {
+		return fmt.Errorf("error reading document form fields: %w", err)
+	}
+
+	widget := types.NewDict()
+	widget.InsertName("Type", "Annot")
+	widget.InsertName("Subtype", "Widget")
+	widget.InsertName("FT", "Sig")
+	widget.InsertString("T", fmt.Sprintf("Signature%d", len(fields)+1))
+	widget.Insert("V", *vRef)
+	// Print and Locked flags.
+	widget.InsertInt("F", 132)
+	widget.Insert("P", *pageRef)
+	widget.Insert("Rect", types.NewRectangle(0, 0, 0, 0).Array())
+	if s.Box != nil {
+		rect, ap, err := signatureAppearance(ctx, *s.Box, inherited.MediaBox, signer, s, now)
+		if err != nil {
+			return err
+		}
+
+		widget.Update("Rect", rect.Array())
+		widget.Insert("AP", types.Dict{"N": *ap})
+	}
+	widgetRef, err := ctx.IndRefForNewObject(widget)
+	if err != nil {
+		return err
+	}
+
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	if err != nil {
+		return fmt.Errorf("error reading annotations of page %d: %w", pageNr, err)
+	}
+	page.Update("Annots", append(annots, *widgetRef))
+	form.Update("Fields", append(fields, *widgetRef))
+	// SignaturesExist and AppendOnly flags.
+	form.Update("SigFlags", types.Integer(3))
+
+	return nil
+}
+
+// Create the appearance of a visible signature, returning its rectangle on the page and a reference to the appearance stream.
+func signatureAppearance(ctx *model.Context, box SignatureBox, mediaBox *types.Rectangle, signer *Signer, s SignatureParams, now time.Time) (*types.Rectangle, *types.IndirectRef, error) {
+	points := func(l Length) float64 {
+		v, _ := l.Inches()
+
+		return v * 72
+	}
+	x, y, w, h := points(box.X), points(box.Y), points(box.Width), points(box.Height)
+	rect := types.NewRectangle(mediaBox.LL.X+x, mediaBox.UR.Y-y-h, mediaBox.LL.X+x+w, mediaBox.UR.Y-y)
+	if rect.LL.X < mediaBox.LL.X || rect.UR.X > mediaBox.UR.X || rect.LL.Y < mediaBox.LL.Y || rect.UR.Y > mediaBox.UR.Y {
+		return nil, nil, NewValidationError("signature box must fit in the page")
+	}
+
+	lines := []string{
+		"Digitally signed by " + signer.Certificate.Subject.CommonName,
+		"Date: " + now.Format("2006-01-02 15:04:05 -07:00"),
+	}
+	if s.Reason != "" {
+		lines = append(lines, "Reason: "+s.Reason)
+	}
+	if s.Location != "" {
+		lines = append(lines, "Location: "+s.Location)
+	}
+
+	// Fit the text in the box, approximating the average width of Helvetica characters to half the font size.
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, len([]rune(line)))
+	}
+	size := min(10, (h-4)/(float64(len(lines))*1.2), (w-8)/(float64(longest)*0.5))
+
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "q 0.2 0.2 0.2 RG 0.5 w 0.25 0.25 %.2f %.2f re S Q\n", w-0.5, h-0.5)
+	fmt.Fprintf(&content, "BT /F1 %.2f Tf %.2f TL 0.2 0.2 0.2 rg 4 %.2f Td\n", size, size*1.2, h-2-size)
+	for _, line := range lines {
+		fmt.Fprintf(&content, "(%s) Tj T*\n", pdfTextString(line))
+	}
+	content.WriteString("ET\n")
+
+	font := types.NewDict()
+	font.InsertName("Type", "Font")
+	font.InsertName("Subtype", "Type1")
+	font.InsertName("BaseFont", "Helvetica")
+	font.InsertName("Encoding", "WinAnsiEncoding")
+
+	sd, err := ctx.NewStreamDictForBuf(content.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	sd.InsertName("Type", "XObject")
+	sd.InsertName("Subtype", "Form")
+	sd.Insert("BBox", types.NewRectangle(0, 0, w, h).Array())
+	sd.Insert("Resources", types.Dict{"Font": types.Dict{"F1": font}})
+	if err := sd.Encode(); err != nil {
+		return nil, nil, err
+	}
+	ap, err := ctx.IndRefForNewObject(*sd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rect, ap, nil
+}
+
+// Escape a string for a PDF literal string shown with a WinAnsi-encoded font, replacing unsupported characters.
+func pdfTextString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0xff:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+
+	return b.String()
+}
+
+// Fill in the byte range and the signature value of a document written after applySignature().
+func signPDF(ctx context.Context, doc []byte, signer *Signer) ([]byte, error) {
+	placeholder := []byte(byteRangePlaceholder.PDFString())
+	rangeStart := bytes.LastIndex(doc, placeholder)
+	contentsStart := bytes.LastIndex(doc, []byte("<"+strings.Repeat("00", signatureSize(signer))+">"))
+	if rangeStart == -1 || contentsStart == -1 {
+		return nil, errors.New("error signing PDF: signature placeholders not found")
+	}
+	contentsEnd := contentsStart + 2*signatureSize(signer) + 2
+
+	byteRange := fmt.Sprintf("[0 %d %d %d", contentsStart, contentsEnd, len(doc)-contentsEnd)
+	byteRange += strings.Repeat(" ", len(placeholder)-len(byteRange)-1) + "]"
+	copy(doc[rangeStart:], byteRange)
+
+	h := sha256.New()
+	h.Write(doc[:contentsStart])
+	h.Write(doc[contentsEnd:])
+
+	signature, err := createCMSSignature(ctx, h.Sum(nil), signer)
+	if err != nil {
+		return nil, fmt.Errorf("error signing PDF: %w", err)
+	}
+	if len(signature) > signatureSize(signer) {
+		return nil, fmt.Errorf("error signing PDF: signature is larger than the reserved %d bytes", signatureSize(signer))
+	}
+	hex.Encode(doc[contentsStart+1:], signature)
+
+	return doc, nil
+}
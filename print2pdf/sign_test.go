@@ -0,0 +1,296 @@
+package print2pdf
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Create a certificate from the template, signed by the parent, or self-signed if the parent is nil.
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+// Create a self-signed certificate authority.
+func newTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	return newTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+}
+
+// Signed data with encapsulated content, as in timestamp tokens.
+type testSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo struct {
+		EContentType asn1.ObjectIdentifier
+		EContent     []byte `asn1:"explicit,tag:0"`
+	}
+	Certificates asn1.RawValue
+	SignerInfos  []cmsSignerInfo `asn1:"set"`
+}
+
+// RFC 3161 timestamp authority answering with tokens signed by its certificate. Timestamp info and signatures can be
+// altered before being sent.
+type testTSA struct {
+	cert      *x509.Certificate
+	key       *ecdsa.PrivateKey
+	info      func(*tsaInfo)
+	signature func([]byte)
+}
+
+func (tsa testTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req tsaRequest
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	info := tsaInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(1),
+		GenTime:        time.Now().UTC().Truncate(time.Second),
+		Nonce:          req.Nonce,
+	}
+	if tsa.info != nil {
+		tsa.info(&info)
+	}
+	eContent, _ := asn1.Marshal(info)
+
+	value := func(v any) asn1.RawValue {
+		der, _ := asn1.Marshal(v)
+
+		return asn1.RawValue{FullBytes: der}
+	}
+	contentDigest := sha256.Sum256(eContent)
+	signedAttrs, _ := asn1.MarshalWithParams([]cmsAttribute{
+		{oidContentType, []asn1.RawValue{value(oidTSTInfo)}},
+		{oidMessageDigest, []asn1.RawValue{value(contentDigest[:])}},
+	}, "set")
+	attrsDigest := sha256.Sum256(signedAttrs)
+	signature, _ := ecdsa.SignASN1(rand.Reader, tsa.key, attrsDigest[:])
+	if tsa.signature != nil {
+		tsa.signature(signature)
+	}
+	signedAttrs[0] = 0xa0
+
+	sd := testSignedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: tsa.cert.Raw},
+		SignerInfos: []cmsSignerInfo{{
+			Version:            1,
+			Sid:                cmsIssuerAndSerialNumber{asn1.RawValue{FullBytes: tsa.cert.RawIssuer}, tsa.cert.SerialNumber},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{FullBytes: signedAttrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          signature,
+		}},
+	}
+	sd.EncapContentInfo.EContentType = oidTSTInfo
+	sd.EncapContentInfo.EContent = eContent
+	content, _ := asn1.Marshal(sd)
+	token, _ := asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+	})
+	res, _ := asn1.Marshal(tsaResponse{TimeStampToken: asn1.RawValue{FullBytes: token}})
+
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(res)
+}
+
+// Find an attribute by type.
+func findAttribute(t *testing.T, raw asn1.RawValue, oid asn1.ObjectIdentifier) []byte {
+	t.Helper()
+
+	attrs, err := parseAttributes(raw)
+	if err != nil {
+		t.Fatalf("error decoding attributes: %s", err)
+	}
+	for _, attr := range attrs {
+		if attr.Type.Equal(oid) && len(attr.Values) == 1 {
+			return attr.Values[0].FullBytes
+		}
+	}
+	t.Fatalf("attribute %s not found", oid)
+
+	return nil
+}
+
+var byteRangeRegexp = regexp.MustCompile(`/ByteRange *\[(\d+) (\d+) (\d+) (\d+) *\]`)
+
+func TestSignPDF(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	cert, key := newTestCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "Test Signer"},
+		KeyUsage: x509.KeyUsageDigitalSignature,
+	}, ca, caKey)
+	tsaCert, tsaKey := newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "Test TSA"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, ca, caKey)
+	tsa := httptest.NewServer(testTSA{cert: tsaCert, key: tsaKey})
+	defer tsa.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	signer := &Signer{Certificate: cert, Key: key, TimestampUrl: tsa.URL, TimestampRoots: roots}
+	p := postProcessing{signature: &SignatureParams{Reason: "Test"}, signer: signer}
+	doc, err := p.apply(context.Background(), testPDF(1))
+	if err != nil {
+		t.Fatalf("error signing PDF: %s", err)
+	}
+	readTestPDF(t, doc)
+
+	m := byteRangeRegexp.FindAllSubmatch(doc, -1)
+	if len(m) != 1 {
+		t.Fatalf("expected a single byte range, found %d", len(m))
+	}
+	var byteRange [4]int
+	for i := range byteRange {
+		byteRange[i], _ = strconv.Atoi(string(m[0][i+1]))
+	}
+	if byteRange[0] != 0 || byteRange[2]+byteRange[3] != len(doc) || doc[byteRange[1]] != '<' || doc[byteRange[2]-1] != '>' {
+		t.Fatalf("byte range %v does not cover the document except the signature", byteRange)
+	}
+	signature, err := hex.DecodeString(string(doc[byteRange[1]+1 : byteRange[2]-1]))
+	if err != nil {
+		t.Fatalf("error decoding signature: %s", err)
+	}
+	content := append(bytes.Clone(doc[:byteRange[1]]), doc[byteRange[2]:]...)
+
+	sd, err := parseSignedData(signature)
+	if err != nil {
+		t.Fatalf("error decoding signature: %s", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidData) || sd.EncapContentInfo.EContent != nil {
+		t.Errorf("expected detached data content, got %s", sd.EncapContentInfo.EContentType)
+	}
+	signerCert, _, err := verifySignedData(sd, content)
+	if err != nil {
+		t.Fatalf("invalid signature: %s", err)
+	}
+	if !signerCert.Equal(cert) {
+		t.Errorf("expected signature by %s, got %s", cert.Subject, signerCert.Subject)
+	}
+	si := sd.SignerInfos[0]
+
+	var essCert essSigningCertificateV2
+	if _, err := asn1.Unmarshal(findAttribute(t, si.SignedAttrs, oidSigningCertificateV2), &essCert); err != nil {
+		t.Fatalf("error decoding signing certificate attribute: %s", err)
+	}
+	certHash := sha256.Sum256(cert.Raw)
+	if len(essCert.Certs) != 1 || !bytes.Equal(essCert.Certs[0].CertHash, certHash[:]) {
+		t.Errorf("signing certificate attribute does not match the signing certificate")
+	}
+
+	token, err := parseSignedData(findAttribute(t, si.UnsignedAttrs, oidTimeStampToken))
+	if err != nil {
+		t.Fatalf("error decoding timestamp token: %s", err)
+	}
+	var info tsaInfo
+	if _, err := asn1.Unmarshal(token.EncapContentInfo.EContent, &info); err != nil {
+		t.Fatalf("error decoding timestamp info: %s", err)
+	}
+	imprint := sha256.Sum256(si.Signature)
+	if !bytes.Equal(info.MessageImprint.HashedMessage, imprint[:]) {
+		t.Errorf("timestamp token is not for the signature")
+	}
+	if err := verifyTimestampToken(token, info.GenTime, roots); err != nil {
+		t.Errorf("invalid timestamp token: %s", err)
+	}
+}
+
+func TestRequestTimestamp(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	otherCA, _ := newTestCA(t)
+	tsaCert, tsaKey := newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "Test TSA"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, ca, caKey)
+	serverCert, serverKey := newTestCertificate(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "Test Server"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+
+	tests := []struct {
+		name  string
+		tsa   testTSA
+		roots *x509.Certificate
+		valid bool
+	}{
+		{"valid", testTSA{cert: tsaCert, key: tsaKey}, ca, true},
+		{"untrusted root", testTSA{cert: tsaCert, key: tsaKey}, otherCA, false},
+		{"not for timestamping", testTSA{cert: serverCert, key: serverKey}, ca, false},
+		{"invalid signature", testTSA{cert: tsaCert, key: tsaKey, signature: func(s []byte) { s[len(s)-1] ^= 1 }}, ca, false},
+		{"other signature", testTSA{cert: tsaCert, key: tsaKey, info: func(i *tsaInfo) { i.MessageImprint.HashedMessage = make([]byte, 32) }}, ca, false},
+		{"other nonce", testTSA{cert: tsaCert, key: tsaKey, info: func(i *tsaInfo) { i.Nonce = big.NewInt(1) }}, ca, false},
+		{"expired", testTSA{cert: tsaCert, key: tsaKey, info: func(i *tsaInfo) { i.GenTime = i.GenTime.Add(2 * time.Hour) }}, ca, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.tsa)
+			defer srv.Close()
+
+			roots := x509.NewCertPool()
+			roots.AddCert(tt.roots)
+			token, err := requestTimestamp(context.Background(), srv.URL, roots, []byte("signature"))
+			if tt.valid && (err != nil || token == nil) {
+				t.Errorf("expected a timestamp token, got error %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("expected an error, got a timestamp token")
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package print2pdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Maximum length of a header or footer template, in bytes.
+const maxTemplateLength = 64 * 1024
+
+// Map of built-in header and footer template names to their HTML markup.
+// Templates can use elements with the classes "pageNumber", "totalPages", "title", "url" and "date",
+// whose content is replaced by Chromium when printing.
+var TemplatesMap = map[string]string{
+	"page-numbers": `<div style="width: 100%; font-size: 9px; text-align: center;">` +
+		`Page <span class="pageNumber"></span> of <span class="totalPages"></span></div>`,
+	"title-date": `<div style="display: flex; width: 100%; margin: 0 0.4in; font-size: 9px;">` +
+		`<span class="title" style="flex: 1;"></span><span class="date"></span></div>`,
+	"title-page-numbers": `<div style="display: flex; width: 100%; margin: 0 0.4in; font-size: 9px;">` +
+		`<span class="title" style="flex: 1;"></span><span><span class="pageNumber"></span> / <span class="totalPages"></span></span></div>`,
+}
+
+// Get the HTML markup of a header or footer template, which is either a built-in template name or HTML markup.
+// Return a validation error if the template is neither a known name nor valid markup.
+func getTemplate(name, template string) (string, error) {
+	if t, ok := TemplatesMap[template]; ok {
+		return t, nil
+	}
+	if !strings.Contains(template, "<") {
+		names := slices.Sorted(maps.Keys(TemplatesMap))
+
+		return "", NewValidationError(fmt.Sprintf("invalid %s \"%s\", must be HTML markup or one of: %s", name, template, strings.Join(names, ", ")))
+	}
+	if len(template) > maxTemplateLength {
+		return "", NewValidationError(fmt.Sprintf("%s is too long, maximum length is %d bytes", name, maxTemplateLength))
+	}
+
+	// Chromium renders templates in isolation: scripts are not run and external resources are not loaded.
+	z := html.NewTokenizer(strings.NewReader(template))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if errors.Is(z.Err(), io.EOF) {
+				return template, nil
+			}
+
+			return "", NewValidationError(fmt.Sprintf("invalid %s: %s", name, z.Err()))
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		t := z.Token()
+		if t.Data == "script" {
+			return "", NewValidationError(fmt.Sprintf("invalid %s: scripts are not supported", name))
+		}
+		for _, attr := range t.Attr {
+			if attr.Key == "src" && !strings.HasPrefix(strings.TrimSpace(attr.Val), "data:") {
+				return "", NewValidationError(fmt.Sprintf("invalid %s: external resources are not supported, use a data URI for \"%s\"", name, attr.Val))
+			}
+		}
+	}
+}
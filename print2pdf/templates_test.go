@@ -0,0 +1,40 @@
+package print2pdf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGetTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+		valid    bool
+	}{
+		{"page-numbers", TemplatesMap["page-numbers"], true},
+		{"title-date", TemplatesMap["title-date"], true},
+		{`<div class="title"></div>`, `<div class="title"></div>`, true},
+		{`<img src="data:image/png;base64,AAAA">`, `<img src="data:image/png;base64,AAAA">`, true},
+		{"", "", false},
+		{"page-number", "", false},
+		{"Page-Numbers", "", false},
+		{"<div><script>alert(1)</script></div>", "", false},
+		{`<img src="https://example.com/logo.png">`, "", false},
+		{"<div>" + strings.Repeat("a", maxTemplateLength) + "</div>", "", false},
+	}
+	for _, tt := range tests {
+		got, err := getTemplate("header_template", tt.template)
+		if !tt.valid {
+			if !errors.As(err, new(ValidationError)) {
+				t.Errorf("getTemplate(%q) error = %v, want a validation error", tt.template, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("getTemplate(%q) error = %v", tt.template, err)
+		} else if got != tt.want {
+			t.Errorf("getTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package print2pdf
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer used to record the package's spans. Exported through the global OpenTelemetry tracer provider.
+var tracer = otel.Tracer("github.com/chialab/print2pdf-go/print2pdf")
+
+// Start a span for a phase of a print, returning its context and a function ending it with the error of the phase,
+// to be used with defer. The duration of the phase is also recorded in metrics, and logged at debug level along with
+// the attributes.
+func startPhase(ctx context.Context, phase string, attrs ...attribute.KeyValue) (context.Context, func(err *error)) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, "print2pdf."+phase, trace.WithAttributes(attrs...))
+
+	return ctx, func(err *error) {
+		d := time.Since(start)
+		if err != nil && *err != nil {
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+		phaseDuration.Record(ctx, d.Seconds(), metric.WithAttributes(attribute.String("phase", phase)))
+
+		args := []any{"phase", phase, durationMs(d)}
+		for _, a := range attrs {
+			args = append(args, slog.Any(string(a.Key), a.Value.AsInterface()))
+		}
+		logger(ctx).DebugContext(ctx, "phase completed", args...)
+	}
+}
@@ -0,0 +1,62 @@
+package print2pdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Length with an optional unit, e.g. "62mm" or "0.5in". Accepted units are "mm", "cm", "in", "px" and "pt".
+// Lengths without unit are in inches. When decoded from JSON, both strings and numbers are accepted.
+type Length string
+
+// Map of accepted units to their value in inches. Pixels are CSS pixels (1/96 inch), points are 1/72 inch.
+var UnitsMap = map[string]float64{
+	"mm": 1 / 25.4,
+	"cm": 1 / 2.54,
+	"in": 1,
+	"px": 1.0 / 96,
+	"pt": 1.0 / 72,
+}
+
+// Implement json.Unmarshaler interface, accepting numbers for backward compatibility.
+func (l *Length) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = Length(s)
+
+		return nil
+	}
+
+	var f json.Number
+	if err := json.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("length must be a number or a string with a unit: %w", err)
+	}
+	*l = Length(f)
+
+	return nil
+}
+
+// Convert the length to inches. Return a validation error if the length is invalid or negative.
+func (l Length) Inches() (float64, error) {
+	s := strings.TrimSpace(string(l))
+	value, unit := s, "in"
+	for u := range UnitsMap {
+		if strings.HasSuffix(s, u) {
+			value, unit = strings.TrimSpace(strings.TrimSuffix(s, u)), u
+			break
+		}
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, NewValidationError(fmt.Sprintf("invalid length \"%s\", must be a number followed by an optional unit among: mm, cm, in, px, pt", l))
+	}
+	if f < 0 {
+		return 0, NewValidationError(fmt.Sprintf("invalid length \"%s\", must not be negative", l))
+	}
+
+	return f * UnitsMap[unit], nil
+}
@@ -0,0 +1,78 @@
+package print2pdf
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLengthInches(t *testing.T) {
+	tests := []struct {
+		length Length
+		want   float64
+		valid  bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"0.5", 0.5, true},
+		{" 2 ", 2, true},
+		{"1in", 1, true},
+		{"25.4mm", 1, true},
+		{"2.54cm", 1, true},
+		{"96px", 1, true},
+		{"72pt", 1, true},
+		{"10 mm", 10 / 25.4, true},
+		{"1e1in", 10, true},
+		{"-1", 0, false},
+		{"-1mm", 0, false},
+		{"mm", 0, false},
+		{"1km", 0, false},
+		{"abc", 0, false},
+		{"NaN", 0, false},
+		{"NaNmm", 0, false},
+		{"Inf", 0, false},
+		{"+Inf", 0, false},
+		{"-Inf", 0, false},
+		{"Infin", 0, false},
+		{"Infinity", 0, false},
+		{"1e400", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := tt.length.Inches()
+		if !tt.valid {
+			if !errors.As(err, new(ValidationError)) {
+				t.Errorf("Length(%q).Inches() error = %v, want a validation error", tt.length, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Length(%q).Inches() error = %v", tt.length, err)
+		} else if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Length(%q).Inches() = %v, want %v", tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestLengthUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json  string
+		want  Length
+		valid bool
+	}{
+		{`"10mm"`, "10mm", true},
+		{`0.5`, "0.5", true},
+		{`1e2`, "1e2", true},
+		{`true`, "", false},
+		{`{}`, "", false},
+	}
+	for _, tt := range tests {
+		var l Length
+		err := json.Unmarshal([]byte(tt.json), &l)
+		if (err == nil) != tt.valid {
+			t.Errorf("json.Unmarshal(%s) error = %v, want valid %v", tt.json, err, tt.valid)
+		} else if l != tt.want {
+			t.Errorf("json.Unmarshal(%s) = %q, want %q", tt.json, l, tt.want)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package print2pdf
 
 import (
-	"fmt"
+	"context"
 	"time"
 )
 
@@ -10,11 +10,13 @@ func Ptr[T any](v T) *T {
 	return &v
 }
 
-// Write Elapsed time, to be used with defer.
+// Log the time elapsed with Logger, to be used with defer.
+//
+// Deprecated: the package logs the duration of each phase of a print by itself.
 func Elapsed(message string) func() {
 	start := time.Now()
 
 	return func() {
-		fmt.Printf("%s: %s\n", message, time.Since(start))
+		logger(context.Background()).Info(message, durationMs(time.Since(start)))
 	}
 }
@@ -0,0 +1,258 @@
+package print2pdf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// Conditions to wait for before printing. All provided conditions must be met: first the events, then the selector,
+// then the expression, and finally the delay.
+type WaitParams struct {
+	// Page events to wait for. Accepted values are "load", "domcontentloaded" and "networkidle". Default is "load".
+	Events []string `json:"events,omitempty"`
+	// CSS selector of an element that must be visible. Default is empty.
+	Selector string `json:"selector,omitempty"`
+	// JavaScript expression that must become truthy, e.g. "window.print2pdfReady === true". Default is empty.
+	Expression string `json:"expression,omitempty"`
+	// Fixed delay in milliseconds, waited after all other conditions are met. Default is 0.
+	Delay int `json:"delay,omitempty"`
+	// Deadline in milliseconds for loading the page and meeting all conditions. Required.
+	Timeout int `json:"timeout"`
+}
+
+// Events waited for when no wait conditions are provided.
+var defaultWaitEvents = []string{"domcontentloaded", "networkidle"}
+
+// Time without requests in flight after which the network is considered idle, as in Chromium's "networkIdle" event.
+const networkIdleTime = 500 * time.Millisecond
+
+// Interval between evaluations of the JavaScript expression to wait for.
+const expressionPollingInterval = 100 * time.Millisecond
+
+// Error returned when the page does not meet the wait conditions before the timeout expires.
+var ErrWaitTimeout = errors.New("timed out waiting for the page to be ready")
+
+// Error returned when the document responds with an HTTP error status, unless AllowHttpErrors is set.
+type HttpStatusError struct {
+	// URL of the document, after redirects.
+	Url string
+	// HTTP status code of the response.
+	StatusCode int
+}
+
+// Implement error interface.
+func (e HttpStatusError) Error() string {
+	return fmt.Sprintf("document %s responded with status %d", e.Url, e.StatusCode)
+}
+
+// Map of accepted wait event names to their Chromium lifecycle event names.
+var lifecycleEvents = map[string]string{
+	"load":             "load",
+	"domcontentloaded": "DOMContentLoaded",
+	"networkidle":      "networkIdle",
+}
+
+// Validate wait conditions. Nil conditions are valid, and mean waiting for the default events without timeout.
+func validateWait(w *WaitParams) error {
+	if w == nil {
+		return nil
+	}
+
+	for _, ev := range w.Events {
+		if _, ok := lifecycleEvents[ev]; !ok {
+			return NewValidationError(fmt.Sprintf("invalid wait event \"%s\", valid events are: load, domcontentloaded, networkidle", ev))
+		}
+	}
+	if w.Delay < 0 {
+		return NewValidationError("wait delay must be a positive number of milliseconds")
+	}
+	if w.Timeout <= 0 {
+		return NewValidationError("wait timeout is required and must be a positive number of milliseconds")
+	}
+	if w.Delay >= w.Timeout {
+		return NewValidationError("wait delay must be shorter than wait timeout")
+	}
+
+	return nil
+}
+
+// Watcher of the loading state of the page in a tab.
+type loadWatcher struct {
+	mu           sync.Mutex
+	changed      chan struct{}                      // Closed, and replaced, every time the state changes.
+	lifecycle    map[cdp.LoaderID]map[string]bool   // Lifecycle events emitted, by loader.
+	requests     map[network.RequestID]struct{}     // Requests in flight.
+	lastActivity time.Time                          // Time of the last request started or completed.
+	responses    map[cdp.LoaderID]*network.Response // Responses of the documents loaded in the main frame, by loader.
+}
+
+// Create a new watcher, listening to events of the tab. Must be called before loading the page.
+func newLoadWatcher(ctx context.Context) *loadWatcher {
+	w := &loadWatcher{
+		changed:      make(chan struct{}),
+		lifecycle:    make(map[cdp.LoaderID]map[string]bool),
+		requests:     make(map[network.RequestID]struct{}),
+		lastActivity: time.Now(),
+		responses:    make(map[cdp.LoaderID]*network.Response),
+	}
+	mainFrame := cdp.FrameID(chromedp.FromContext(ctx).Target.TargetID)
+
+	chromedp.ListenTarget(ctx, func(ev any) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		switch ev := ev.(type) {
+		case *page.EventLifecycleEvent:
+			if w.lifecycle[ev.LoaderID] == nil {
+				w.lifecycle[ev.LoaderID] = make(map[string]bool)
+			}
+			w.lifecycle[ev.LoaderID][ev.Name] = true
+		case *network.EventRequestWillBeSent:
+			w.requests[ev.RequestID] = struct{}{}
+			w.lastActivity = time.Now()
+		case *network.EventResponseReceived:
+			// Only the final response is reported, redirects being part of the request.
+			if ev.Type == network.ResourceTypeDocument && ev.FrameID == mainFrame {
+				w.responses[ev.LoaderID] = ev.Response
+			}
+
+			return
+		case *network.EventLoadingFinished:
+			delete(w.requests, ev.RequestID)
+			w.lastActivity = time.Now()
+		case *network.EventLoadingFailed:
+			delete(w.requests, ev.RequestID)
+			w.lastActivity = time.Now()
+		default:
+			return
+		}
+
+		close(w.changed)
+		w.changed = make(chan struct{})
+	})
+
+	return w
+}
+
+// Wait until the condition, evaluated with the lock held, is met. The condition returns whether it is met,
+// and how long to wait before evaluating it again in absence of state changes (zero means until the next change).
+func (w *loadWatcher) waitUntil(ctx context.Context, condition func() (bool, time.Duration)) error {
+	for {
+		w.mu.Lock()
+		met, retry := condition()
+		changed := w.changed
+		w.mu.Unlock()
+		if met {
+			return nil
+		}
+
+		var timer <-chan time.Time
+		if retry > 0 {
+			timer = time.After(retry)
+		}
+		select {
+		case <-changed:
+		case <-timer:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Get the response of the document loaded by the navigation with the given loader, if received.
+func (w *loadWatcher) response(loaderID cdp.LoaderID) *network.Response {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.responses[loaderID]
+}
+
+// Wait for a lifecycle event of the navigation with the given loader.
+func (w *loadWatcher) waitLifecycle(ctx context.Context, loaderID cdp.LoaderID, name string) error {
+	return w.waitUntil(ctx, func() (bool, time.Duration) {
+		return w.lifecycle[loaderID][name], 0
+	})
+}
+
+// Wait until no request has been in flight for networkIdleTime.
+func (w *loadWatcher) waitNetworkIdle(ctx context.Context) error {
+	return w.waitUntil(ctx, func() (bool, time.Duration) {
+		if len(w.requests) > 0 {
+			return false, 0
+		}
+		idle := time.Since(w.lastActivity)
+
+		return idle >= networkIdleTime, networkIdleTime - idle
+	})
+}
+
+// Wait for a page event. An empty loader means the document was replaced in place, without a navigation,
+// so no lifecycle events are emitted and the document state is checked instead.
+func (w *loadWatcher) waitEvent(ctx context.Context, loaderID cdp.LoaderID, event string) error {
+	if loaderID != "" {
+		return w.waitLifecycle(ctx, loaderID, lifecycleEvents[event])
+	}
+
+	switch event {
+	case "domcontentloaded":
+		return chromedp.Poll(`document.readyState !== "loading"`, nil, chromedp.WithPollingTimeout(0)).Do(ctx)
+	case "load":
+		return chromedp.Poll(`document.readyState === "complete"`, nil, chromedp.WithPollingTimeout(0)).Do(ctx)
+	default:
+		return w.waitNetworkIdle(ctx)
+	}
+}
+
+// Wait for all conditions to be met. The loader is the one of the navigation that loaded the page, if any.
+func (w *loadWatcher) wait(ctx context.Context, loaderID cdp.LoaderID, conditions *WaitParams) error {
+	if conditions == nil {
+		for _, ev := range defaultWaitEvents {
+			if err := w.waitEvent(ctx, loaderID, ev); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	events := conditions.Events
+	if len(events) == 0 {
+		events = []string{"load"}
+	}
+	for _, ev := range events {
+		if err := w.waitEvent(ctx, loaderID, ev); err != nil {
+			return err
+		}
+	}
+
+	if conditions.Selector != "" {
+		if err := chromedp.WaitVisible(conditions.Selector, chromedp.ByQuery).Do(ctx); err != nil {
+			return err
+		}
+	}
+
+	if conditions.Expression != "" {
+		err := chromedp.Poll(conditions.Expression, nil, chromedp.WithPollingInterval(expressionPollingInterval), chromedp.WithPollingTimeout(0)).Do(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if conditions.Delay > 0 {
+		select {
+		case <-time.After(time.Duration(conditions.Delay) * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
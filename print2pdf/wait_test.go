@@ -0,0 +1,34 @@
+package print2pdf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateWait(t *testing.T) {
+	tests := []struct {
+		name  string
+		wait  *WaitParams
+		valid bool
+	}{
+		{"nil", nil, true},
+		{"timeout only", &WaitParams{Timeout: 1000}, true},
+		{"all conditions", &WaitParams{Events: []string{"load", "networkidle"}, Selector: "#ready", Expression: "window.ready", Delay: 500, Timeout: 1000}, true},
+		{"no timeout", &WaitParams{Events: []string{"load"}}, false},
+		{"zero timeout", &WaitParams{Timeout: 0}, false},
+		{"negative timeout", &WaitParams{Timeout: -1}, false},
+		{"unknown event", &WaitParams{Events: []string{"networkidle0"}, Timeout: 1000}, false},
+		{"event with wrong case", &WaitParams{Events: []string{"DOMContentLoaded"}, Timeout: 1000}, false},
+		{"negative delay", &WaitParams{Delay: -1, Timeout: 1000}, false},
+		{"delay as long as timeout", &WaitParams{Delay: 1000, Timeout: 1000}, false},
+	}
+	for _, tt := range tests {
+		err := validateWait(tt.wait)
+		if tt.valid && err != nil {
+			t.Errorf("validateWait() %s error = %v", tt.name, err)
+		}
+		if !tt.valid && !errors.As(err, new(ValidationError)) {
+			t.Errorf("validateWait() %s error = %v, want a validation error", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package print2pdf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/color"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Maximum length of the watermark text.
+const maxWatermarkTextLength = 256
+
+// Maximum size of the decoded watermark image.
+const maxWatermarkImageSize = 5 << 20
+
+// Maximum number of pixels of the watermark image, which is decoded in full when stamped.
+const maxWatermarkImagePixels = 4096 * 4096
+
+// Positions of the watermark on the page.
+var PositionsMap = map[string]types.Anchor{
+	"top-left":     types.TopLeft,
+	"top":          types.TopCenter,
+	"top-right":    types.TopRight,
+	"left":         types.Left,
+	"center":       types.Center,
+	"right":        types.Right,
+	"bottom-left":  types.BottomLeft,
+	"bottom":       types.BottomCenter,
+	"bottom-right": types.BottomRight,
+}
+
+// A text or an image stamped over the content of the pages of the generated PDF.
+type WatermarkParams struct {
+	// Text of the watermark, in Latin-1 characters. Either Text or Image is required.
+	Text string `json:"text,omitempty"`
+	// Image of the watermark, as a base64 data URI of a PNG or JPEG image. Either Text or Image is required.
+	Image string `json:"image,omitempty"`
+	// Color of the text, as a hex code (e.g. "#ff0000"). Default is gray.
+	Color string `json:"color,omitempty"`
+	// Opacity, from 0 to 1. Default is 0.5.
+	Opacity *float64 `json:"opacity,omitempty"`
+	// Rotation in degrees, from -180 to 180, counterclockwise. Default is along the page diagonal for text, 0 for images.
+	Rotation *float64 `json:"rotation,omitempty"`
+	// Position on the page. See PositionsMap for valid values. Default is "center".
+	Position string `json:"position,omitempty"`
+	// Size relative to the page width, from 0 to 1. Default is 0.5.
+	Scale float64 `json:"scale,omitempty"`
+	// Pages to stamp, as a comma-separated list of page numbers and ranges (e.g. "1,3-5", "2-", "odd", "even").
+	// Default is all pages.
+	Pages string `json:"pages,omitempty"`
+}
+
+// Validate watermark options for the given output.
+func validateWatermark(output string, w *WatermarkParams) error {
+	if w == nil {
+		return nil
+	}
+	if output != "pdf" {
+		return NewValidationError("watermark can only be used with pdf output")
+	}
+
+	if (w.Text == "") == (w.Image == "") {
+		return NewValidationError("watermark requires either text or image")
+	}
+	if w.Text != "" {
+		if len(w.Text) > maxWatermarkTextLength {
+			return NewValidationError(fmt.Sprintf("watermark text is too long, maximum is %d bytes", maxWatermarkTextLength))
+		}
+		if strings.IndexFunc(w.Text, func(r rune) bool { return r > 0xff }) != -1 {
+			return NewValidationError("watermark text must only contain Latin-1 characters")
+		}
+	}
+	if w.Image != "" {
+		if w.Color != "" {
+			return NewValidationError("watermark color can only be used with text")
+		}
+		if _, err := decodeWatermarkImage(w.Image); err != nil {
+			return err
+		}
+	}
+
+	if w.Color != "" {
+		if _, err := color.NewSimpleColorForHexCode(w.Color); err != nil {
+			return NewValidationError(fmt.Sprintf("invalid watermark color \"%s\", must be a hex code like #ff0000", w.Color))
+		}
+	}
+	if w.Opacity != nil && (*w.Opacity < 0 || *w.Opacity > 1) {
+		return NewValidationError("watermark opacity must be a number between 0 and 1")
+	}
+	if w.Rotation != nil && (*w.Rotation < -180 || *w.Rotation > 180) {
+		return NewValidationError("watermark rotation must be a number between -180 and 180")
+	}
+	if _, ok := PositionsMap[w.Position]; w.Position != "" && !ok {
+		return NewValidationError(fmt.Sprintf("invalid watermark position \"%s\", valid positions are: %s", w.Position, strings.Join(slices.Sorted(maps.Keys(PositionsMap)), ", ")))
+	}
+	if w.Scale < 0 || w.Scale > 1 {
+		return NewValidationError("watermark scale must be a number between 0 and 1")
+	}
+	if w.Pages != "" {
+		if _, err := api.ParsePageSelection(w.Pages); err != nil {
+			return NewValidationError(fmt.Sprintf("invalid watermark pages \"%s\"", w.Pages))
+		}
+	}
+
+	return nil
+}
+
+// Decode the watermark image from a base64 data URI, checking it is a supported image of acceptable dimensions.
+func decodeWatermarkImage(uri string) ([]byte, error) {
+	mediaType, data, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ";base64,")
+	if !strings.HasPrefix(uri, "data:") || !ok || !slices.Contains([]string{"image/png", "image/jpeg"}, mediaType) {
+		return nil, NewValidationError("watermark image must be a base64 data URI of a PNG or JPEG image")
+	}
+	if base64.StdEncoding.DecodedLen(len(data)) > maxWatermarkImageSize {
+		return nil, NewValidationError(fmt.Sprintf("watermark image is too large, maximum is %d bytes", maxWatermarkImageSize))
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, NewValidationError("watermark image is not valid base64")
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(buf))
+	if err != nil {
+		return nil, NewValidationError(fmt.Sprintf("watermark image cannot be decoded: %s", err))
+	}
+	if int64(config.Width)*int64(config.Height) > maxWatermarkImagePixels {
+		return nil, NewValidationError(fmt.Sprintf("watermark image is too large, maximum is %d pixels", maxWatermarkImagePixels))
+	}
+
+	return buf, nil
+}
+
+// Stamp the watermark over the content of the selected pages.
+func applyWatermark(ctx *model.Context, w WatermarkParams) error {
+	var wm *model.Watermark
+	var err error
+	if w.Text != "" {
+		wm, err = pdfcpu.ParseTextWatermarkDetails(w.Text, "", true, types.POINTS)
+	} else {
+		wm, err = pdfcpu.ParseImageWatermarkDetails("", "", true, types.POINTS)
+	}
+	if err != nil {
+		return err
+	}
+
+	if w.Image != "" {
+		buf, err := decodeWatermarkImage(w.Image)
+		if err != nil {
+			return err
+		}
+		wm.Image = bytes.NewReader(buf)
+		wm.Diagonal = model.NoDiagonal
+	}
+	if w.Color != "" {
+		c, err := color.NewSimpleColorForHexCode(w.Color)
+		if err != nil {
+			return err
+		}
+		wm.Color, wm.FillColor, wm.StrokeColor = c, c, c
+	}
+
+	wm.Opacity = 0.5
+	if w.Opacity != nil {
+		wm.Opacity = *w.Opacity
+	}
+	if w.Rotation != nil {
+		wm.Rotation = *w.Rotation
+		wm.Diagonal = model.NoDiagonal
+		wm.UserRotOrDiagonal = true
+	}
+	if w.Position != "" {
+		wm.Pos = PositionsMap[w.Position]
+	}
+	if w.Scale > 0 {
+		wm.Scale = w.Scale
+	}
+
+	var selection []string
+	if w.Pages != "" {
+		if selection, err = api.ParsePageSelection(w.Pages); err != nil {
+			return err
+		}
+	}
+	pages, err := api.PagesForPageSelection(ctx.PageCount, selection, true, false)
+	if err != nil {
+		return fmt.Errorf("error selecting watermark pages: %w", err)
+	}
+
+	if err := api.WatermarkContext(ctx, pages, wm); err != nil {
+		return fmt.Errorf("error adding watermark: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package print2pdf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// Get the content of each page of a PDF document.
+func pageContents(t *testing.T, doc []byte) [][]byte {
+	t.Helper()
+
+	ctx := readTestPDF(t, doc)
+	if err := ctx.EnsurePageCount(); err != nil {
+		t.Fatal(err)
+	}
+	contents := make([][]byte, ctx.PageCount)
+	for i := range contents {
+		d, _, _, err := ctx.PageDict(i+1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contents[i], err = ctx.PageContent(d, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return contents
+}
+
+func TestApplyWatermark(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		params  WatermarkParams
+		stamped []bool
+	}{
+		{"text", WatermarkParams{Text: "DRAFT"}, []bool{true, true, true}},
+		{"image", WatermarkParams{Image: "data:image/png;base64," + base64.StdEncoding.EncodeToString(img.Bytes())}, []bool{true, true, true}},
+		{"pages", WatermarkParams{Text: "DRAFT", Pages: "2-"}, []bool{false, true, true}},
+		{"odd pages", WatermarkParams{Text: "DRAFT", Pages: "odd"}, []bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := testPDF(len(tt.stamped))
+			before := pageContents(t, doc)
+
+			out, err := processPDF(doc, postProcessing{watermark: &tt.params}.steps()...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after := pageContents(t, out)
+
+			for i, stamped := range tt.stamped {
+				if changed := !bytes.Equal(before[i], after[i]); changed != stamped {
+					t.Errorf("page %d content changed is %v, want %v", i+1, changed, stamped)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeWatermarkImage(t *testing.T) {
+	// Build a PNG declaring the given dimensions, with no image data, which is enough to decode its configuration.
+	header := func(width, height uint32) string {
+		ihdr := binary.BigEndian.AppendUint32([]byte("IHDR"), width)
+		ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+		ihdr = append(ihdr, 8, 0, 0, 0, 0)
+		buf := []byte("\x89PNG\r\n\x1a\n")
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(ihdr)-4))
+		buf = append(buf, ihdr...)
+		buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(ihdr))
+
+		return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf)
+	}
+
+	tests := []struct {
+		name  string
+		uri   string
+		valid bool
+	}{
+		{"small", header(100, 100), true},
+		{"maximum size", header(4096, 4096), true},
+		{"huge", header(60000, 60000), false},
+		{"too wide", header(maxWatermarkImagePixels+1, 1), false},
+		{"not an image", "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("not an image")), false},
+		{"not a data URI", "https://example.com/image.png", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeWatermarkImage(tt.uri)
+			if tt.valid && err != nil {
+				t.Errorf("expected image to be valid, got %s", err)
+			}
+			if !tt.valid {
+				if _, ok := err.(ValidationError); !ok {
+					t.Errorf("expected a validation error, got %v", err)
+				}
+			}
+		})
+	}
+}